@@ -0,0 +1,311 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+/*
+Builder builds a state transition table from a fluent chain of definitions. A
+state is defined with State, a transition for an event of that state with On,
+and the transition's properties with the methods that follow On. Branch starts a
+branch of the transition, and the methods that follow Branch define the branch
+instead.
+
+Mistakes in the chain are kept by the builder and returned by Build, so the
+chain never has to be interrupted to check for errors.
+*/
+type Builder struct {
+	err      error
+	event    Event
+	root     *Transition
+	state    State
+	states   StateTransitionTable
+	targeted map[*Transition]bool
+	tran     *Transition
+	trans    []built
+}
+
+type built struct {
+	event Event
+	state State
+	tran  *Transition
+}
+
+/*
+Build returns a new builder with no states defined.
+*/
+func Build() *Builder {
+	return &Builder{states: StateTransitionTable{}, targeted: map[*Transition]bool{}}
+}
+
+/*
+State defines a state and makes it the state that following transitions are
+defined for. It is an error to define a state twice.
+*/
+func (b *Builder) State(s State) *Builder {
+	if _, ok := b.states[s]; ok {
+		b.fail(s, NoEvent, "state defined more than once")
+	}
+
+	b.states[s] = map[Event]*Transition{}
+	b.root = nil
+	b.state = s
+	b.tran = nil
+
+	return b
+}
+
+/*
+On defines a transition for an event of the current state and makes it the
+transition that following properties are defined for. It is an error to define
+a transition before a state, or to define a transition for the same state and
+event twice.
+*/
+func (b *Builder) On(e Event) *Builder {
+	events, ok := b.states[b.state]
+
+	if !ok {
+		b.fail(b.state, e, "transition defined before any state")
+
+		return b
+	}
+
+	if _, ok := events[e]; ok {
+		b.fail(b.state, e, "transition defined more than once")
+	}
+
+	b.tran = &Transition{}
+	b.event = e
+	b.root = b.tran
+	events[e] = b.tran
+	b.trans = append(b.trans, built{e, b.state, b.tran})
+
+	return b
+}
+
+/*
+Branch adds a branch to the transition defined by the last call to On and makes
+the branch the transition that following properties are defined for. Branches
+are tried in the order they are added, so a branch without a guard should be
+added last as the default.
+*/
+func (b *Builder) Branch() *Builder {
+	if _, ok := b.transition("branch"); !ok {
+		return b
+	}
+
+	branch := &Transition{}
+	b.root.Branches = append(b.root.Branches, branch)
+	b.trans = append(b.trans, built{b.event, b.state, branch})
+	b.tran = branch
+
+	return b
+}
+
+/*
+GoTo sets the state the current transition transitions to. The state must be
+defined by the time the table is built.
+*/
+func (b *Builder) GoTo(s State) *Builder {
+	if tran, ok := b.transition("target"); ok {
+		tran.To = s
+		b.targeted[tran] = true
+	}
+
+	return b
+}
+
+/*
+Internal makes the current transition an internal transition.
+*/
+func (b *Builder) Internal() *Builder {
+	if tran, ok := b.transition("internal kind"); ok {
+		tran.Internal = true
+	}
+
+	return b
+}
+
+/*
+Reversible makes the current transition one the machine can undo.
+*/
+func (b *Builder) Reversible() *Builder {
+	if tran, ok := b.transition("reversible flag"); ok {
+		tran.Reversible = true
+	}
+
+	return b
+}
+
+/*
+Final makes the current transition stop the machine after the state change.
+*/
+func (b *Builder) Final() *Builder {
+	if tran, ok := b.transition("final flag"); ok {
+		tran.IsFinal = true
+	}
+
+	return b
+}
+
+/*
+Guard sets the guard of the current transition.
+*/
+func (b *Builder) Guard(guard func(s State, e Event) bool) *Builder {
+	if tran, ok := b.hook("guard", guard == nil); ok {
+		tran.Guard = guard
+	}
+
+	return b
+}
+
+/*
+ExtGuard sets the extended state guard of the current transition.
+*/
+func (b *Builder) ExtGuard(guard func(s State, e Event, x ExtendedState) bool) *Builder {
+	if tran, ok := b.hook("extended state guard", guard == nil); ok {
+		tran.ExtGuard = guard
+	}
+
+	return b
+}
+
+/*
+GuardV2 sets the v2 guard of the current transition.
+*/
+func (b *Builder) GuardV2(guard HookFunc) *Builder {
+	if tran, ok := b.hook("v2 guard", guard == nil); ok {
+		tran.GuardV2 = guard
+	}
+
+	return b
+}
+
+/*
+Action sets the extended state action of the current transition.
+*/
+func (b *Builder) Action(action func(s State, e Event, x ExtendedState) ExtendedState) *Builder {
+	if tran, ok := b.hook("action", action == nil); ok {
+		tran.Action = action
+	}
+
+	return b
+}
+
+/*
+OnSuccess sets the successful state change handler of the current transition.
+*/
+func (b *Builder) OnSuccess(hook func(s State, e Event)) *Builder {
+	if tran, ok := b.hook("success hook", hook == nil); ok {
+		tran.OnSuccess = hook
+	}
+
+	return b
+}
+
+/*
+OnSuccessV2 sets the v2 successful state change handler of the current
+transition.
+*/
+func (b *Builder) OnSuccessV2(hook HookFunc) *Builder {
+	if tran, ok := b.hook("v2 success hook", hook == nil); ok {
+		tran.OnSuccessV2 = hook
+	}
+
+	return b
+}
+
+/*
+OnFail sets the failed state change handler of the current transition.
+*/
+func (b *Builder) OnFail(hook func(s State, e Event)) *Builder {
+	if tran, ok := b.hook("failure hook", hook == nil); ok {
+		tran.OnFail = hook
+	}
+
+	return b
+}
+
+/*
+OnFailV2 sets the v2 failed state change handler of the current transition.
+*/
+func (b *Builder) OnFailV2(hook HookFunc) *Builder {
+	if tran, ok := b.hook("v2 failure hook", hook == nil); ok {
+		tran.OnFailV2 = hook
+	}
+
+	return b
+}
+
+/*
+OnUndo sets the v2 inverse hook of the current transition, invoked when it is
+undone.
+*/
+func (b *Builder) OnUndo(hook HookFunc) *Builder {
+	if tran, ok := b.hook("undo hook", hook == nil); ok {
+		tran.OnUndo = hook
+	}
+
+	return b
+}
+
+/*
+Build returns the state transition table that was defined. It will return an
+error for the first mistake made in the chain of definitions. It will return an
+error if no states were defined. It will return an error if an external
+transition without branches has no target, or if a transition targets a state
+that was not defined. The builder must not be used after Build.
+*/
+func (b *Builder) Build() (StateTransitionTable, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if len(b.states) == 0 {
+		return nil, &ErrMissingStates{"no states defined"}
+	}
+
+	for _, t := range b.trans {
+		if t.tran.Internal || len(t.tran.Branches) > 0 {
+			continue
+		}
+
+		if !b.targeted[t.tran] {
+			return nil, &ErrInvalidDefinition{t.state, t.event, "transition has no target"}
+		}
+
+		if _, ok := b.states[t.tran.To]; !ok || t.tran.To == AnyState {
+			return nil, &ErrInvalidDefinition{t.state, t.event, "transition target not defined"}
+		}
+	}
+
+	return b.states, nil
+}
+
+func (b *Builder) transition(property string) (*Transition, bool) {
+	if b.tran == nil {
+		b.fail(b.state, NoEvent, property+" defined before any transition")
+
+		return nil, false
+	}
+
+	return b.tran, true
+}
+
+func (b *Builder) hook(property string, isNil bool) (*Transition, bool) {
+	tran, ok := b.transition(property)
+
+	if ok && isNil {
+		b.fail(b.state, b.event, property+" is nil")
+
+		return nil, false
+	}
+
+	return tran, ok
+}
+
+func (b *Builder) fail(s State, e Event, msg string) {
+	if b.err == nil {
+		b.err = &ErrInvalidDefinition{s, e, msg}
+	}
+}
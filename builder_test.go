@@ -0,0 +1,183 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should build table":                      shouldBuildTable,
+		"should build branches":                   shouldBuildBranches,
+		"should build wildcard and internal":      shouldBuildWildcardInternal,
+		"should build reversible transition":      shouldBuildReversible,
+		"should err when state duplicated":        shouldErrBuildDuplicateState,
+		"should err when transition duplicated":   shouldErrBuildDuplicateTran,
+		"should err when target undefined":        shouldErrBuildUndefinedTarget,
+		"should err when target missing":          shouldErrBuildMissingTarget,
+		"should err when hook nil":                shouldErrBuildNilHook,
+		"should err when transition before state": shouldErrBuildTranBeforeState,
+		"should err when property before event":   shouldErrBuildPropertyBeforeEvent,
+		"should err when no states defined":       shouldErrBuildNoStates,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldBuildTable(t *testing.T, name string) {
+	guarded := false
+	guard := func(s cism.State, e cism.Event) bool {
+		guarded = true
+
+		return true
+	}
+	stt, err := cism.Build().
+		State(cism.State(1)).
+		On(cism.Event(1)).GoTo(cism.State(2)).Guard(guard).
+		State(cism.State(2)).
+		On(cism.Event(2)).GoTo(cism.State(3)).Final().
+		State(cism.State(3)).
+		Build()
+	machine := &cism.Machine{States: stt}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+
+	if err != nil || len(stt) != 3 || len(stt[cism.State(3)]) != 0 || !stt[cism.State(2)][cism.Event(2)].IsFinal ||
+		!guarded || startErr != nil || sendErr != nil || sendErr2 != nil || machine.Current() != cism.State(3) ||
+		machine.Send(cism.Event(1)) == nil {
+		t.Fail()
+		t.Logf("%s: table not built", name)
+	}
+}
+
+func shouldBuildBranches(t *testing.T, name string) {
+	stt, err := cism.Build().
+		State(cism.State(1)).
+		On(cism.Event(1)).
+		Branch().GoTo(cism.State(2)).Guard(func(s cism.State, e cism.Event) bool { return false }).
+		Branch().GoTo(cism.State(3)).
+		State(cism.State(2)).
+		State(cism.State(3)).
+		Build()
+	machine := &cism.Machine{States: stt}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if err != nil || len(stt[cism.State(1)][cism.Event(1)].Branches) != 2 || startErr != nil || sendErr != nil ||
+		machine.Current() != cism.State(3) {
+		t.Fail()
+		t.Logf("%s: branches not built", name)
+	}
+}
+
+func shouldBuildWildcardInternal(t *testing.T, name string) {
+	stt, err := cism.Build().
+		State(cism.State(1)).
+		On(cism.Event(1)).Internal().
+		State(cism.AnyState).
+		On(cism.AnyEvent).GoTo(cism.State(1)).
+		Build()
+
+	if err != nil || !stt[cism.State(1)][cism.Event(1)].Internal ||
+		stt.GetTransition(cism.State(1), cism.Event(2)) != stt[cism.AnyState][cism.AnyEvent] {
+		t.Fail()
+		t.Logf("%s: wildcard and internal not built", name)
+	}
+}
+
+func shouldBuildReversible(t *testing.T, name string) {
+	undone := false
+	undo := func(tc *cism.TransitionContext) error {
+		undone = true
+
+		return nil
+	}
+	stt, err := cism.Build().
+		State(cism.State(1)).
+		On(cism.Event(1)).GoTo(cism.State(1)).Reversible().OnUndo(undo).
+		Build()
+	tran := stt[cism.State(1)][cism.Event(1)]
+
+	if err != nil || !tran.Reversible || tran.OnUndo == nil || tran.OnUndo(&cism.TransitionContext{}) != nil ||
+		!undone {
+		t.Fail()
+		t.Logf("%s: reversible transition not built", name)
+	}
+}
+
+func shouldErrBuild(t *testing.T, name string, b *cism.Builder, s cism.State, e cism.Event) {
+	var buildErr *cism.ErrInvalidDefinition
+	stt, err := b.Build()
+
+	if stt != nil || err == nil || err.Error() == "" || !errors.As(err, &buildErr) || buildErr.State != s ||
+		buildErr.Event != e {
+		t.Fail()
+		t.Logf("%s: did not error correctly: %v", name, err)
+	}
+}
+
+func shouldErrBuildDuplicateState(t *testing.T, name string) {
+	b := cism.Build().State(cism.State(1)).On(cism.Event(1)).GoTo(cism.State(1)).State(cism.State(1))
+
+	shouldErrBuild(t, name, b, cism.State(1), cism.NoEvent)
+}
+
+func shouldErrBuildDuplicateTran(t *testing.T, name string) {
+	b := cism.Build().
+		State(cism.State(1)).
+		On(cism.Event(1)).GoTo(cism.State(1)).
+		On(cism.Event(2)).GoTo(cism.State(1)).
+		On(cism.Event(1)).GoTo(cism.State(1))
+
+	shouldErrBuild(t, name, b, cism.State(1), cism.Event(1))
+}
+
+func shouldErrBuildUndefinedTarget(t *testing.T, name string) {
+	b := cism.Build().
+		State(cism.State(1)).On(cism.Event(1)).GoTo(cism.State(1)).
+		State(cism.State(2)).On(cism.Event(2)).GoTo(cism.State(3))
+
+	shouldErrBuild(t, name, b, cism.State(2), cism.Event(2))
+}
+
+func shouldErrBuildMissingTarget(t *testing.T, name string) {
+	b := cism.Build().State(cism.State(0)).On(cism.Event(1)).Final()
+
+	shouldErrBuild(t, name, b, cism.State(0), cism.Event(1))
+}
+
+func shouldErrBuildNilHook(t *testing.T, name string) {
+	b := cism.Build().State(cism.State(1)).On(cism.Event(1)).GoTo(cism.State(1)).OnSuccess(nil)
+
+	shouldErrBuild(t, name, b, cism.State(1), cism.Event(1))
+}
+
+func shouldErrBuildTranBeforeState(t *testing.T, name string) {
+	b := cism.Build().On(cism.Event(1))
+
+	shouldErrBuild(t, name, b, cism.State(0), cism.Event(1))
+}
+
+func shouldErrBuildPropertyBeforeEvent(t *testing.T, name string) {
+	b := cism.Build().State(cism.State(1)).GoTo(cism.State(1))
+
+	shouldErrBuild(t, name, b, cism.State(1), cism.NoEvent)
+}
+
+func shouldErrBuildNoStates(t *testing.T, name string) {
+	var machineErr *cism.ErrMissingStates
+	stt, err := cism.Build().Build()
+
+	if stt != nil || err == nil || !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
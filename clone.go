@@ -0,0 +1,79 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+/*
+Clone returns an independent copy of the machine. The copy has the machine's
+current state, status, history log, dead letter log, deferred and queued
+events, and a clone of its extended state, so events sent to either machine do
+not affect the other. The copy shares the machine's state transition table,
+state configuration, hooks, and interceptors, but none of its listeners or
+subscribers. Clone must not be called while an event is being sent.
+*/
+func (m *Machine) Clone() *Machine {
+	c := &Machine{
+		Compiled:     m.Compiled,
+		Configs:      m.Configs,
+		Extended:     m.Extended,
+		HistoryLimit: m.HistoryLimit,
+		LogLevels:    m.LogLevels,
+		Logger:       m.Logger,
+		MaxEventless: m.MaxEventless,
+		Metrics:      m.Metrics,
+		Names:        m.Names,
+		OnUnhandled:  m.OnUnhandled,
+		ProbeGuards:  m.ProbeGuards,
+		Profiling:    m.Profiling,
+		ReuseErrors:  m.ReuseErrors,
+		States:       m.States,
+		Tracer:       m.Tracer,
+		Unhandled:    m.Unhandled,
+		WhilePaused:  m.WhilePaused,
+		attemptevt:   m.attemptevt,
+		attempts:     m.attempts,
+		completed:    m.completed,
+		curr:         m.curr,
+		dead:         append([]DeadLetter(nil), m.dead...),
+		deferred:     append([]pending(nil), m.deferred...),
+		done:         m.done,
+		entered:      m.entered,
+		ext:          cloneExtended(m.ext),
+		hist:         m.hist.clone(),
+		initial:      m.initial,
+		paused:       m.paused,
+		pausedat:     m.pausedat,
+		queued:       append([]pending(nil), m.queued...),
+		redo:         append([]HistoryRecord(nil), m.redo...),
+		resend:       m.resend,
+		started:      m.started,
+		undofloor:    m.undofloor,
+	}
+
+	for _, hist := range m.archive {
+		c.archive = append(c.archive, append([]HistoryRecord(nil), hist...))
+	}
+
+	if m.endevt != nil {
+		c.endval = *m.endevt
+		c.endevt = &c.endval
+	}
+
+	if len(m.interceptors) > 0 {
+		c.Use(m.interceptors...)
+	}
+
+	if c.done {
+		c.donech = make(chan struct{})
+
+		close(c.donech)
+	}
+
+	c.pub.curr.Store(int64(c.curr))
+	c.pub.seq.Store(m.pub.seq.Load())
+	c.pub.state.Store(int64(c.curr))
+	c.pub.status.Store(int32(c.status()))
+
+	return c
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_Clone(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should copy position and history":  shouldCloneCopyState,
+		"should not share with the machine": shouldCloneIndependent,
+		"should copy stopped machine":       shouldCloneStopped,
+		"should copy interceptors":          shouldCloneInterceptors,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldCloneCopyState(t *testing.T, name string) {
+	machine := &cism.Machine{Extended: &counter{}, HistoryLimit: 2, States: benchTable()}
+	machine.States[cism.State(1)][cism.Event(1)].Action = cism.TypedAction(
+		func(s cism.State, e cism.Event, c *counter) *counter {
+			return &counter{c.count + 1}
+		})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(1))
+	clone := machine.Clone()
+	hist := clone.History()
+
+	if clone.Position() != machine.Position() || clone.Status() != cism.Running || len(hist) != 2 ||
+		hist[0].Event != cism.Event(2) || hist[1].Event != cism.Event(1) ||
+		clone.CurrentExtended().(*counter).count != 2 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil || sendErr3 != nil {
+		t.Fail()
+		t.Logf("%s: state not copied: %v %v", name, clone.Position(), hist)
+	}
+}
+
+func shouldCloneIndependent(t *testing.T, name string) {
+	machine := &cism.Machine{HistoryLimit: 2, States: benchTable()}
+	var kinds []cism.TransitionEventKind
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		kinds = append(kinds, ev.Kind)
+	})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	clone := machine.Clone()
+	cloneErr := clone.Send(cism.Event(2))
+	cloneErr2 := clone.Send(cism.Event(1))
+	cloneErr3 := clone.Send(cism.Event(2))
+	hist := machine.History()
+
+	if machine.Current() != cism.State(2) || clone.Current() != cism.State(1) || len(hist) != 1 ||
+		hist[0].Event != cism.Event(1) || len(clone.History()) != 2 || len(kinds) != 2 || startErr != nil ||
+		sendErr != nil || cloneErr != nil || cloneErr2 != nil || cloneErr3 != nil {
+		t.Fail()
+		t.Logf("%s: clone shared state: %v %v", name, hist, clone.History())
+	}
+}
+
+func shouldCloneStopped(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(3))
+	clone := machine.Clone()
+	closed := false
+
+	select {
+	case <-clone.Done():
+		closed = true
+	default:
+	}
+
+	if clone.Status() != cism.Completed || clone.FinalEvent() == nil || *clone.FinalEvent() != cism.Event(3) ||
+		!closed || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: stopped machine not copied: %v", name, clone.Status())
+	}
+}
+
+func shouldCloneInterceptors(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	seen := 0
+	machine.Use(func(next cism.Handler) cism.Handler {
+		return func(req *cism.Request) error {
+			seen++
+
+			return next(req)
+		}
+	})
+	startErr := machine.Start(cism.State(1))
+	clone := machine.Clone()
+	cloneErr := clone.Send(cism.Event(1))
+
+	if seen != 1 || clone.Current() != cism.State(2) || machine.Current() != cism.State(1) || startErr != nil ||
+		cloneErr != nil {
+		t.Fail()
+		t.Logf("%s: interceptors not copied", name)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "sort"
+
+const (
+	denseMin   = 64      // span of IDs that is always dense
+	denseRatio = 4       // span of IDs per defined ID that is still dense
+	denseCells = 1 << 20 // limit of transitions in a dense table
+)
+
+/*
+CompiledTable is an immutable state transition table compiled for fast lookups.
+Transitions for wildcards are resolved when the table is compiled, so a lookup
+never consults more than one entry. States and events are indexed by dense
+slices when their IDs are small and contiguous, and by maps otherwise.
+
+The transitions of a compiled table are shared with the table it was compiled
+from, and must not be modified after compiling. Changes to the state transition
+table after compiling are not seen by the compiled table.
+*/
+type CompiledTable struct {
+	anyrow    *compiledRow
+	anystates []State
+	byevent   [][]State
+	emin      Event
+	eindex    map[Event]int
+	events    []Event
+	eventless []State
+	rows      []compiledRow
+	sindex    map[State]int
+	smin      State
+	states    []State
+	width     int
+}
+
+type compiledRow struct {
+	anyevent  *Transition
+	defined   bool
+	eventless *Transition
+	events    []Event
+	trans     []*Transition
+}
+
+/*
+Compile returns an immutable compiled table with the same transitions as the
+state transition table.
+*/
+func (stt StateTransitionTable) Compile() *CompiledTable {
+	ct := &CompiledTable{}
+	seen := map[Event]bool{}
+
+	for s, events := range stt {
+		if s != AnyState {
+			ct.states = append(ct.states, s)
+		}
+
+		for e := range events {
+			if e != AnyEvent && e != NoEvent && !seen[e] {
+				seen[e] = true
+				ct.events = append(ct.events, e)
+			}
+		}
+	}
+
+	sort.Slice(ct.states, func(i, j int) bool { return ct.states[i] < ct.states[j] })
+	sort.Slice(ct.events, func(i, j int) bool { return ct.events[i] < ct.events[j] })
+
+	sspan, espan := uint(0), uint(0)
+
+	if len(ct.states) > 0 {
+		sspan = uint(ct.states[len(ct.states)-1]) - uint(ct.states[0]) + 1
+		ct.smin = ct.states[0]
+	}
+
+	if len(ct.events) > 0 {
+		espan = uint(ct.events[len(ct.events)-1]) - uint(ct.events[0]) + 1
+		ct.emin = ct.events[0]
+	}
+
+	rows := uint(len(ct.states))
+
+	if !dense(sspan, len(ct.states)) {
+		ct.sindex = make(map[State]int, len(ct.states))
+
+		for i, s := range ct.states {
+			ct.sindex[s] = i
+		}
+	} else {
+		rows = sspan
+	}
+
+	ct.width = len(ct.events)
+
+	if dense(espan, len(ct.events)) && rows*espan <= denseCells {
+		ct.width = int(espan)
+	} else {
+		ct.eindex = make(map[Event]int, len(ct.events))
+
+		for i, e := range ct.events {
+			ct.eindex[e] = i
+		}
+	}
+
+	ct.rows = make([]compiledRow, rows)
+	ct.anystates = stt.GetStatesForEvent(AnyEvent)
+	ct.eventless = stt.GetStatesForEvent(NoEvent)
+	ct.byevent = make([][]State, ct.width)
+
+	for _, s := range ct.states {
+		ct.compileRow(stt, s, &ct.rows[ct.stateIndex(s)])
+	}
+
+	for i := range ct.byevent {
+		ct.byevent[i] = stt.GetStatesForEvent(ct.event(i))
+	}
+
+	if _, ok := stt[AnyState]; ok {
+		ct.anyrow = &compiledRow{}
+		ct.compileRow(stt, AnyState, ct.anyrow)
+	}
+
+	return ct
+}
+
+func dense(span uint, count int) bool {
+	return span <= denseMin || span <= uint(denseRatio*count)
+}
+
+func (ct *CompiledTable) compileRow(stt StateTransitionTable, s State, row *compiledRow) {
+	row.anyevent = stt.GetTransition(s, AnyEvent)
+	row.defined = true
+	row.eventless = stt.GetTransition(s, NoEvent)
+	row.events = stt.GetEventsForState(s)
+	row.trans = make([]*Transition, ct.width)
+
+	for i := range row.trans {
+		row.trans[i] = stt.GetTransition(s, ct.event(i))
+	}
+}
+
+func (ct *CompiledTable) event(i int) Event {
+	if ct.eindex != nil {
+		return ct.events[i]
+	}
+
+	return ct.emin + Event(i)
+}
+
+func (ct *CompiledTable) stateIndex(s State) int {
+	if ct.sindex != nil {
+		if i, ok := ct.sindex[s]; ok {
+			return i
+		}
+
+		return -1
+	}
+
+	if i := uint(s) - uint(ct.smin); i < uint(len(ct.rows)) {
+		return int(i)
+	}
+
+	return -1
+}
+
+func (ct *CompiledTable) eventIndex(e Event) int {
+	if ct.eindex != nil {
+		if i, ok := ct.eindex[e]; ok {
+			return i
+		}
+
+		return -1
+	}
+
+	if i := uint(e) - uint(ct.emin); i < uint(ct.width) && e != AnyEvent && e != NoEvent {
+		return int(i)
+	}
+
+	return -1
+}
+
+func (ct *CompiledTable) row(s State) *compiledRow {
+	if s == AnyState {
+		return ct.anyrow
+	}
+
+	if i := ct.stateIndex(s); i >= 0 && ct.rows[i].defined {
+		return &ct.rows[i]
+	}
+
+	return nil
+}
+
+/*
+HasState returns whether the given state is defined in the table.
+*/
+func (ct *CompiledTable) HasState(s State) bool {
+	return ct.row(s) != nil
+}
+
+/*
+GetTransition returns the same transition as GetTransition of the state
+transition table the compiled table was compiled from.
+*/
+func (ct *CompiledTable) GetTransition(s State, e Event) *Transition {
+	row := ct.row(s)
+
+	if row == nil {
+		return nil
+	}
+
+	if e == NoEvent {
+		return row.eventless
+	}
+
+	if i := ct.eventIndex(e); i >= 0 {
+		return row.trans[i]
+	}
+
+	return row.anyevent
+}
+
+/*
+GetEventsForState returns the same events as GetEventsForState of the state
+transition table the compiled table was compiled from, sorted in ascending
+order.
+*/
+func (ct *CompiledTable) GetEventsForState(s State) []Event {
+	row := ct.row(s)
+
+	if row == nil || len(row.events) == 0 {
+		return nil
+	}
+
+	events := make([]Event, len(row.events))
+
+	copy(events, row.events)
+
+	return events
+}
+
+/*
+GetStatesForEvent returns the same states as GetStatesForEvent of the state
+transition table the compiled table was compiled from, sorted in ascending
+order.
+*/
+func (ct *CompiledTable) GetStatesForEvent(e Event) []State {
+	states := ct.anystates
+
+	if e == NoEvent {
+		states = ct.eventless
+	} else if i := ct.eventIndex(e); i >= 0 {
+		states = ct.byevent[i]
+	}
+
+	if len(states) == 0 {
+		return nil
+	}
+
+	cpystates := make([]State, len(states))
+
+	copy(cpystates, states)
+
+	return cpystates
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"sort"
+	"testing"
+)
+
+func TestStateTransitionTable_Compile(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should match table with dense IDs":  shouldCompileDense,
+		"should match table with sparse IDs": shouldCompileSparse,
+		"should match table with nil values": shouldCompileNil,
+		"should not see later table changes": shouldCompileImmutable,
+		"should run machine on compiled":     shouldRunMachineCompiled,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func compilableTable(states []cism.State, events []cism.Event) cism.StateTransitionTable {
+	stt := cism.StateTransitionTable{}
+
+	for i, s := range states {
+		stt[s] = map[cism.Event]*cism.Transition{}
+
+		for j, e := range events {
+			if (i+j)%3 != 0 {
+				stt[s][e] = &cism.Transition{To: states[(i+1)%len(states)]}
+			}
+		}
+	}
+
+	stt[states[0]][cism.AnyEvent] = &cism.Transition{To: states[0]}
+	stt[states[1]][cism.NoEvent] = &cism.Transition{To: states[0]}
+	stt[cism.AnyState] = map[cism.Event]*cism.Transition{
+		events[0]: {To: states[1]},
+	}
+
+	return stt
+}
+
+func shouldMatchCompiled(t *testing.T, name string, stt cism.StateTransitionTable, probes []cism.Event) {
+	ct := stt.Compile()
+	states := append([]cism.State{cism.AnyState, cism.State(-7)}, make([]cism.State, 0, len(stt))...)
+
+	for s := range stt {
+		states = append(states, s)
+	}
+
+	for _, s := range states {
+		if ct.HasState(s) != (stt[s] != nil) {
+			t.Fail()
+			t.Logf("%s: state %d defined differently", name, s)
+		}
+
+		events := stt.GetEventsForState(s)
+		sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
+		if !equalEvents(ct.GetEventsForState(s), events) {
+			t.Fail()
+			t.Logf("%s: events for state %d differ", name, s)
+		}
+
+		for _, e := range probes {
+			if ct.GetTransition(s, e) != stt.GetTransition(s, e) {
+				t.Fail()
+				t.Logf("%s: transition for state %d and event %d differs", name, s, e)
+			}
+		}
+	}
+
+	for _, e := range probes {
+		states := stt.GetStatesForEvent(e)
+		sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
+		if !equalStates(ct.GetStatesForEvent(e), states) {
+			t.Fail()
+			t.Logf("%s: states for event %d differ", name, e)
+		}
+	}
+}
+
+func equalEvents(a []cism.Event, b []cism.Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalStates(a []cism.State, b []cism.State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func shouldCompileNil(t *testing.T, name string) {
+	stt := cism.StateTransitionTable{
+		cism.State(1): {cism.Event(1): nil, cism.NoEvent: nil},
+		cism.State(2): {cism.AnyEvent: nil},
+		cism.State(3): {cism.Event(2): {To: cism.State(1)}},
+	}
+	probes := []cism.Event{cism.AnyEvent, cism.NoEvent, 1, 2, 3}
+
+	shouldMatchCompiled(t, name, stt, probes)
+}
+
+func shouldCompileDense(t *testing.T, name string) {
+	states := []cism.State{1, 2, 3, 4, 5}
+	events := []cism.Event{10, 11, 12, 14}
+	probes := append([]cism.Event{cism.AnyEvent, cism.NoEvent, 13, 9, 15}, events...)
+
+	shouldMatchCompiled(t, name, compilableTable(states, events), probes)
+}
+
+func shouldCompileSparse(t *testing.T, name string) {
+	states := []cism.State{-1 << 40, 3, 1000, 1 << 40}
+	events := []cism.Event{-5, 7, 1 << 50}
+	probes := append([]cism.Event{cism.AnyEvent, cism.NoEvent, 6, 8, 1<<50 + 1}, events...)
+
+	shouldMatchCompiled(t, name, compilableTable(states, events), probes)
+}
+
+func shouldCompileImmutable(t *testing.T, name string) {
+	stt := compilableTable([]cism.State{1, 2}, []cism.Event{1, 2})
+	ct := stt.Compile()
+	tran := ct.GetTransition(cism.State(1), cism.Event(2))
+	stt[cism.State(1)][cism.Event(2)] = &cism.Transition{To: cism.State(1)}
+	stt[cism.State(3)] = map[cism.Event]*cism.Transition{}
+
+	if ct.GetTransition(cism.State(1), cism.Event(2)) != tran || ct.HasState(cism.State(3)) {
+		t.Fail()
+		t.Logf("%s: compiled table changed", name)
+	}
+}
+
+func shouldRunMachineCompiled(t *testing.T, name string) {
+	machine := &cism.Machine{Compiled: benchTable().Compile()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(3))
+
+	if startErr != nil || sendErr != nil || sendErr2 == nil || machine.Current() != cism.State(2) ||
+		machine.Start(cism.State(9)) == nil {
+		t.Fail()
+		t.Logf("%s: machine did not run on compiled table", name)
+	}
+}
+
+func benchTable() cism.StateTransitionTable {
+	return cism.StateTransitionTable{
+		cism.State(1): {cism.Event(1): &cism.Transition{To: cism.State(2)}},
+		cism.State(2): {cism.Event(2): &cism.Transition{To: cism.State(1)}},
+		cism.AnyState: {cism.Event(4): &cism.Transition{Internal: true}},
+	}
+}
+
+func BenchmarkStateTransitionTable_GetTransition(b *testing.B) {
+	stt := benchTable()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = stt.GetTransition(cism.State(1+i%2), cism.Event(4))
+	}
+}
+
+func BenchmarkCompiledTable_GetTransition(b *testing.B) {
+	ct := benchTable().Compile()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = ct.GetTransition(cism.State(1+i%2), cism.Event(4))
+	}
+}
+
+func benchSend(b *testing.B, machine *cism.Machine) {
+	if err := machine.Start(cism.State(1)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = machine.Send(cism.Event(1 + i%2))
+	}
+}
+
+func BenchmarkMachine_Send(b *testing.B) {
+	benchSend(b, &cism.Machine{States: benchTable()})
+}
+
+func BenchmarkMachine_SendCompiled(b *testing.B) {
+	benchSend(b, &cism.Machine{Compiled: benchTable().Compile()})
+}
@@ -0,0 +1,569 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+type delivery struct {
+	ctx     context.Context
+	payload interface{}
+	err     error
+	outcome string
+	changed bool
+	final   bool
+}
+
+func (d *delivery) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *delivery) decide(outcome string) {
+	if d.outcome == "" {
+		d.outcome = outcome
+	}
+}
+
+func (d *delivery) result(err error) string {
+	if err == nil {
+		return d.outcome
+	}
+
+	if _, ok := err.(*ErrMissingTransition); ok {
+		return OutcomeUnhandled
+	}
+
+	return OutcomeFailed
+}
+
+type pending struct {
+	event   Event
+	payload interface{}
+}
+
+type step struct {
+	from   State
+	tran   *Transition
+	branch int
+}
+
+func (m *Machine) dispatch(e Event, d *delivery, redispatch bool) error {
+	m.attempt(e)
+
+	tran := m.lookup(m.curr, e)
+
+	if tran == nil {
+		return m.unhandled(e, d, redispatch)
+	}
+
+	from := m.curr
+
+	if !m.transition(tran, e, d) {
+		m.publish()
+
+		return d.err
+	}
+
+	if err := m.complete(from, d); err != nil {
+		d.fail(err)
+	}
+
+	m.publish()
+	m.redispatch()
+
+	return d.err
+}
+
+func (m *Machine) complete(rest State, d *delivery) error {
+	limit := m.maxEventless()
+	var err error
+
+	for count := 0; !m.done; count++ {
+		if m.pseudo(m.curr) == RealState {
+			rest = m.curr
+		}
+
+		tran := m.lookup(m.curr, NoEvent)
+
+		if tran == nil {
+			break
+		}
+
+		if count == limit {
+			err = &ErrEventlessLoop{m.curr, limit, "eventless transitions exceeded limit"}
+
+			break
+		}
+
+		if !m.transition(tran, NoEvent, d) {
+			break
+		}
+	}
+
+	if m.pseudo(m.curr) != RealState {
+		if err == nil {
+			err = &ErrChoiceStuck{m.curr, "no branch passed for choice"}
+		}
+
+		m.rollback(rest, d)
+	}
+
+	return err
+}
+
+func (m *Machine) rollback(rest State, d *delivery) {
+	from := m.curr
+
+	m.exit(from, NoEvent, d)
+
+	if m.Metrics != nil {
+		now := time.Now()
+
+		m.Metrics.Dwell(from, now.Sub(m.entered))
+		m.Metrics.Transition(from, NoEvent, rest)
+
+		m.entered = now
+	}
+
+	m.hist.push(HistoryRecord{from, NoEvent, rest, -1, RollbackTransition})
+	m.curr = rest
+
+	m.track()
+
+	m.logTransition(d.ctx, "choice rolled back", from, rest, NoEvent, true)
+	m.enter(rest, NoEvent, d)
+	m.emit(TransitionRolledBack, from, rest, NoEvent)
+}
+
+func (m *Machine) unhandled(e Event, d *delivery, redispatch bool) error {
+	m.emit(EventUnhandled, m.curr, m.curr, e)
+	d.decide(OutcomeUnhandled)
+
+	if m.Metrics != nil {
+		m.Metrics.Unhandled(m.curr, e)
+	}
+
+	policy := m.Unhandled
+	hook := m.OnUnhandled
+
+	if conf := m.Configs[m.curr]; conf != nil {
+		if conf.Unhandled != UnhandledDefault {
+			policy = conf.Unhandled
+		}
+
+		if conf.OnUnhandled != nil {
+			hook = conf.OnUnhandled
+		}
+	}
+
+	switch {
+	case policy == UnhandledDefer:
+		m.logUnhandled(d.ctx, "event deferred", m.curr, e, false)
+		m.deferred = append(m.deferred, pending{e, d.payload})
+	case policy == UnhandledHook && hook != nil:
+		m.logUnhandled(d.ctx, "event routed to hook", m.curr, e, false)
+
+		if m.sim == nil {
+			start := m.hookStart(d.ctx, m.curr, e)
+			hook(m.curr, e)
+			m.hookEnd(d.ctx, "OnUnhandled", m.curr, e, start)
+		}
+	case policy == UnhandledIgnore || policy == UnhandledHook || redispatch:
+		m.logUnhandled(d.ctx, "event ignored", m.curr, e, false)
+		m.dead = append(m.dead, DeadLetter{m.curr, e})
+	default:
+		m.logUnhandled(d.ctx, "event unhandled", m.curr, e, true)
+
+		return m.missing(m.curr, e, "no transition found for event in current state")
+	}
+
+	return nil
+}
+
+func (m *Machine) redispatch() {
+	if m.redispatched {
+		m.changed = true
+
+		return
+	}
+
+	m.redispatched = true
+
+	defer func() {
+		m.redispatched = false
+	}()
+
+	for len(m.deferred) > 0 && !m.done && !m.paused {
+		deferred := m.deferred
+		m.deferred = nil
+		m.changed = false
+
+		for i, p := range deferred {
+			if m.done || m.paused {
+				m.deferred = append(m.deferred, deferred[i:]...)
+
+				break
+			}
+
+			_ = m.dispatch(p.event, &delivery{ctx: context.Background(), payload: p.payload}, true)
+		}
+
+		if !m.changed {
+			break
+		}
+	}
+
+	m.resend = m.paused && len(m.deferred) > 0
+}
+
+func (m *Machine) transition(tran *Transition, e Event, d *delivery) bool {
+	currstate := m.curr
+
+	if m.Profiling {
+		defer m.region(d.ctx, e).End()
+	}
+
+	if m.canceled(e, d) {
+		return false
+	}
+
+	taken, branch := m.resolve(tran, currstate, e, d)
+	var path []step
+
+	if taken != nil && !taken.Internal {
+		var ok bool
+
+		if path, ok = m.junctions(taken.To, d); !ok {
+			taken = nil
+		}
+	}
+
+	if m.canceled(e, d) {
+		return false
+	}
+
+	if taken == nil {
+		if e != NoEvent {
+			m.fail(tran, currstate, e, d)
+		}
+
+		return false
+	}
+
+	if taken.Internal {
+		m.hist.push(HistoryRecord{currstate, e, currstate, branch, InternalTransition})
+		m.redo = m.redo[:0]
+
+		m.logTransition(d.ctx, "internal transition", currstate, currstate, e, true)
+		d.decide(OutcomeAccepted)
+
+		if m.Metrics != nil {
+			m.Metrics.Transition(currstate, e, currstate)
+		}
+
+		m.act(taken, currstate, currstate, e, d)
+		m.emit(TransitionAccepted, currstate, currstate, e)
+		m.finish(taken.IsFinal, d)
+
+		return false
+	}
+
+	final := taken.IsFinal
+
+	m.change(step{currstate, taken, branch}, e, d)
+
+	for _, junction := range path {
+		final = final || junction.tran.IsFinal
+
+		m.change(junction, NoEvent, d)
+	}
+
+	m.finish(final, d)
+
+	return true
+}
+
+func (m *Machine) finish(final bool, d *delivery) {
+	if !final && !d.final {
+		return
+	}
+
+	if m.pseudo(m.curr) != RealState {
+		d.final = true
+
+		return
+	}
+
+	m.stop(true)
+}
+
+func (m *Machine) canceled(e Event, d *delivery) bool {
+	if d.changed {
+		return false
+	}
+
+	if err := d.ctx.Err(); err != nil {
+		d.fail(&ErrCanceled{m.curr, e, err, "send canceled before state change"})
+
+		return true
+	}
+
+	return false
+}
+
+func (m *Machine) resolve(tran *Transition, s State, e Event, d *delivery) (*Transition, int) {
+	if !m.passes(tran, s, e, d) {
+		return nil, -1
+	}
+
+	if len(tran.Branches) == 0 {
+		return tran, -1
+	}
+
+	for i, branch := range tran.Branches {
+		if branch != nil && m.passes(branch, s, e, d) {
+			return branch, i
+		}
+	}
+
+	return nil, -1
+}
+
+func (m *Machine) passes(tran *Transition, s State, e Event, d *delivery) bool {
+	if tran.unguarded() {
+		return true
+	}
+
+	var parent context.Context
+	var span Span
+
+	if m.Tracer != nil {
+		parent, span = m.startSpan(d, GuardSpan, s, e)
+
+		span.SetAttribute("to", m.Names.State(tran.target(s)))
+	}
+
+	start := m.hookStart(d.ctx, s, e)
+	passed := m.guard(tran, s, e, d)
+
+	m.unlabel(d.ctx)
+	m.logGuard(d.ctx, s, tran.target(s), e, passed, start)
+
+	if span != nil {
+		span.SetAttribute("passed", strconv.FormatBool(passed))
+		span.End()
+
+		d.ctx = parent
+	}
+
+	return passed
+}
+
+func (m *Machine) guard(tran *Transition, s State, e Event, d *delivery) bool {
+	if m.sim != nil && m.sim.Guard != nil {
+		return m.sim.Guard(s, e, tran.target(s))
+	}
+
+	if tran.Guard != nil && !tran.Guard(s, e) {
+		return false
+	}
+
+	if tran.ExtGuard != nil && !tran.ExtGuard(s, e, m.ext) {
+		return false
+	}
+
+	return tran.GuardV2 == nil || tran.GuardV2(m.context(s, tran.target(s), e, d)) == nil
+}
+
+func (m *Machine) fail(tran *Transition, s State, e Event, d *delivery) {
+	m.logTransition(d.ctx, "transition rejected", s, tran.target(s), e, false)
+	m.emit(TransitionRejected, s, tran.target(s), e)
+	d.decide(OutcomeRejected)
+
+	if m.Metrics != nil {
+		m.Metrics.Rejected(s, e)
+	}
+
+	if m.sim != nil {
+		return
+	}
+
+	if tran.OnFail != nil {
+		start := m.hookStart(d.ctx, s, e)
+		tran.OnFail(s, e)
+		m.hookEnd(d.ctx, "OnFail", s, e, start)
+	}
+
+	if tran.OnFailV2 != nil {
+		start := m.hookStart(d.ctx, s, e)
+		err := tran.OnFailV2(m.context(s, tran.target(s), e, d))
+		m.hookEnd(d.ctx, "OnFailV2", s, e, start)
+
+		if err != nil {
+			d.fail(&ErrHookFailed{s, e, err, "transition failure hook returned an error"})
+		}
+	}
+}
+
+func (m *Machine) change(st step, e Event, d *delivery) {
+	m.exit(st.from, e, d)
+
+	if m.Metrics != nil {
+		now := time.Now()
+
+		m.Metrics.Dwell(st.from, now.Sub(m.entered))
+		m.Metrics.Transition(st.from, e, st.tran.To)
+
+		m.entered = now
+	}
+
+	m.hist.push(HistoryRecord{st.from, e, st.tran.To, st.branch, ExternalTransition})
+	m.curr = st.tran.To
+	m.redo = m.redo[:0]
+	d.changed = true
+
+	m.track()
+
+	m.logTransition(d.ctx, "state changed", st.from, st.tran.To, e, true)
+	d.decide(OutcomeAccepted)
+	m.act(st.tran, st.from, st.tran.To, e, d)
+	m.enter(st.tran.To, e, d)
+	m.emit(TransitionAccepted, st.from, st.tran.To, e)
+
+	m.attempts = 0
+}
+
+func (m *Machine) act(tran *Transition, from State, to State, e Event, d *delivery) {
+	if m.Tracer == nil || (tran.Action == nil && tran.OnSuccess == nil && tran.OnSuccessV2 == nil) {
+		m.actions(tran, from, to, e, d)
+
+		return
+	}
+
+	parent, span := m.startSpan(d, ActionSpan, from, e)
+
+	span.SetAttribute("to", m.Names.State(to))
+	m.actions(tran, from, to, e, d)
+	span.End()
+
+	d.ctx = parent
+}
+
+func (m *Machine) actions(tran *Transition, from State, to State, e Event, d *delivery) {
+	if m.sim != nil {
+		return
+	}
+
+	if tran.Action != nil {
+		start := m.hookStart(d.ctx, from, e)
+		m.ext = tran.Action(from, e, m.ext)
+		m.hookEnd(d.ctx, "Action", from, e, start)
+	}
+
+	if tran.OnSuccess != nil {
+		start := m.hookStart(d.ctx, from, e)
+		tran.OnSuccess(from, e)
+		m.hookEnd(d.ctx, "OnSuccess", from, e, start)
+	}
+
+	if tran.OnSuccessV2 != nil {
+		start := m.hookStart(d.ctx, from, e)
+		tc := m.context(from, to, e, d)
+		err := tran.OnSuccessV2(tc)
+		m.ext = tc.Extended
+		m.hookEnd(d.ctx, "OnSuccessV2", from, e, start)
+
+		if err != nil {
+			d.fail(&ErrHookFailed{from, e, err, "transition success hook returned an error"})
+		}
+	}
+}
+
+func (m *Machine) junctions(s State, d *delivery) ([]step, bool) {
+	var path []step
+
+	for m.pseudo(s) == JunctionState {
+		if len(path) == m.maxEventless() {
+			return nil, false
+		}
+
+		tran := m.lookup(s, NoEvent)
+
+		if tran == nil {
+			return nil, false
+		}
+
+		taken, branch := m.resolve(tran, s, NoEvent, d)
+
+		if taken == nil || taken.Internal {
+			return nil, false
+		}
+
+		path = append(path, step{s, taken, branch})
+		s = taken.To
+	}
+
+	return path, true
+}
+
+func (m *Machine) attempt(e Event) {
+	if e != m.attemptevt {
+		m.attemptevt = e
+		m.attempts = 0
+	}
+
+	m.attempts++
+}
+
+func (m *Machine) context(from State, to State, e Event, d *delivery) *TransitionContext {
+	attempt := 1
+
+	if e == m.attemptevt && m.attempts > 0 {
+		attempt = m.attempts
+	}
+
+	if m.viewer == nil {
+		m.viewer = &view{m}
+	}
+
+	return &TransitionContext{attempt, d.ctx, e, m.ext, from, m.viewer, d.payload, to}
+}
+
+func (m *Machine) pseudo(s State) PseudoKind {
+	if conf := m.Configs[s]; conf != nil {
+		return conf.Pseudo
+	}
+
+	return RealState
+}
+
+func (m *Machine) maxEventless() int {
+	if m.MaxEventless <= 0 {
+		return DefaultMaxEventless
+	}
+
+	return m.MaxEventless
+}
+
+func (m *Machine) enter(s State, e Event, d *delivery) {
+	if conf := m.Configs[s]; conf != nil && conf.OnEnter != nil && m.sim == nil {
+		start := m.hookStart(d.ctx, s, e)
+		conf.OnEnter(s, e)
+		m.hookEnd(d.ctx, "OnEnter", s, e, start)
+	}
+}
+
+func (m *Machine) exit(s State, e Event, d *delivery) {
+	if conf := m.Configs[s]; conf != nil && conf.OnExit != nil && m.sim == nil {
+		start := m.hookStart(d.ctx, s, e)
+		conf.OnExit(s, e)
+		m.hookEnd(d.ctx, "OnExit", s, e, start)
+	}
+}
@@ -29,6 +29,10 @@ state can be viewed for the purposes of logging or other introspections. A
 history log is also kept that maintains past states and the events that
 triggered the transitions.
 
+A state machine can own an extended state, which is a context value passed to
+extended guards and actions. Actions return the updated extended state, so the
+machine always holds the data its guards depend on.
+
 Example code:
 
 	package main
@@ -46,11 +50,19 @@ Example code:
 
 	const (
 		SetupDone cism.Event = iota
+		Progress
 		WorkComplete
 	)
 
+	type Work struct {
+		ReallyComplete bool
+	}
+
+	func (w *Work) Clone() cism.ExtendedState {
+		return &Work{w.ReallyComplete}
+	}
+
 	func main() {
-		workReallyComplete := false
 		stt := cism.StateTransitionTable{
 			Begin: {
 				SetupDone: &cism.Transition{
@@ -61,14 +73,17 @@ Example code:
 				},
 			},
 			Middle: {
+				Progress: &cism.Transition{
+					Action: cism.TypedAction(func(s cism.State, e cism.Event, w *Work) *Work {
+						return &Work{ReallyComplete: true}
+					}),
+					Internal: true,
+				},
 				WorkComplete: &cism.Transition{
-					Guard: func(s cism.State, e cism.Event) bool {
-						return workReallyComplete
-					},
+					ExtGuard: cism.TypedGuard(func(s cism.State, e cism.Event, w *Work) bool {
+						return w.ReallyComplete
+					}),
 					IsFinal: true,
-					OnFail: func(s cism.State, e cism.Event) {
-						workReallyComplete = true
-					},
 					OnSuccess: func(s cism.State, e cism.Event) {
 						fmt.Println("left 'Middle' state and entered 'End' state")
 					},
@@ -78,12 +93,14 @@ Example code:
 			End: {}, // done
 		}
 		machine := &cism.Machine{
-			States: stt,
+			Extended: &Work{},
+			States:   stt,
 		}
 
 		machine.Start(Begin)
 		machine.Send(SetupDone)
 		machine.Send(WorkComplete) // fails transition
+		machine.Send(Progress)     // work is really complete now
 		machine.Send(WorkComplete) // succeeds this time
 		machine.Stop()
 		machine.Reset()
@@ -4,6 +4,8 @@
 
 package cism
 
+import "fmt"
+
 /*
 ErrMissingStates represents an error when a machine is attempting to be started
 without a state transition table defined. It satisfies the Error interface.
@@ -113,3 +115,214 @@ Error returns the error message assigned at struct creation.
 func (e *ErrMachineNotStopped) Error() string {
 	return e.msg
 }
+
+/*
+ErrMachinePaused represents an error when a machine is paused and an event is
+sent to it under the PauseReject policy. It satisfies the Error interface.
+*/
+type ErrMachinePaused struct {
+	State State
+	Event Event
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrMachinePaused) Error() string {
+	return e.msg
+}
+
+/*
+ErrNotReversible represents an error when a machine is asked to undo or redo a
+transition it cannot. The State and Event are those of the transition that
+cannot be undone, or the current state and NoEvent if there is nothing to undo
+or redo. It satisfies the Error interface.
+*/
+type ErrNotReversible struct {
+	State State
+	Event Event
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrNotReversible) Error() string {
+	return e.msg
+}
+
+/*
+ErrInvalidIndex represents an error when a machine is asked to rewind to an
+index outside of its history log. It satisfies the Error interface.
+*/
+type ErrInvalidIndex struct {
+	Index int
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrInvalidIndex) Error() string {
+	return e.msg
+}
+
+/*
+ErrEventlessLoop represents an error when a machine takes more eventless
+transitions in a row than its limit allows. It satisfies the Error interface.
+*/
+type ErrEventlessLoop struct {
+	State State
+	Limit int
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrEventlessLoop) Error() string {
+	return e.msg
+}
+
+/*
+ErrChoiceStuck represents an error when a machine enters a choice and none of
+the choice's branches pass. It satisfies the Error interface.
+*/
+type ErrChoiceStuck struct {
+	State State
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrChoiceStuck) Error() string {
+	return e.msg
+}
+
+/*
+ErrInvalidPseudoState represents an error when a machine's pseudo-state is not
+defined correctly in its state transition table. It satisfies the Error
+interface.
+*/
+type ErrInvalidPseudoState struct {
+	State State
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrInvalidPseudoState) Error() string {
+	return e.msg
+}
+
+/*
+ErrHookFailed represents an error returned by a v2 lifecycle hook of a
+transition. It satisfies the Error interface, and unwraps to the hook's error.
+*/
+type ErrHookFailed struct {
+	State State
+	Event Event
+	Err   error
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation, followed by the
+hook's error message.
+*/
+func (e *ErrHookFailed) Error() string {
+	return e.msg + ": " + e.Err.Error()
+}
+
+/*
+Unwrap returns the error returned by the hook.
+*/
+func (e *ErrHookFailed) Unwrap() error {
+	return e.Err
+}
+
+/*
+ErrGuardFailed represents an error returned by an adapted guard when the guard
+blocks a state change. It satisfies the Error interface.
+*/
+type ErrGuardFailed struct {
+	State State
+	Event Event
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrGuardFailed) Error() string {
+	return e.msg
+}
+
+/*
+ErrCanceled represents an error when the context of a send is done before the
+state change occurs. It satisfies the Error interface, and unwraps to the
+context's error.
+*/
+type ErrCanceled struct {
+	State State
+	Event Event
+	Err   error
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation, followed by the
+context's error message.
+*/
+func (e *ErrCanceled) Error() string {
+	return e.msg + ": " + e.Err.Error()
+}
+
+/*
+Unwrap returns the context's error.
+*/
+func (e *ErrCanceled) Unwrap() error {
+	return e.Err
+}
+
+/*
+ErrPanic represents a panic recovered while a machine handled an event. It
+satisfies the Error interface.
+*/
+type ErrPanic struct {
+	State State
+	Event Event
+	Value interface{}
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation, followed by the
+panic value.
+*/
+func (e *ErrPanic) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.Value)
+}
+
+/*
+ErrInvalidDefinition represents an error when a builder is given a definition
+that would make an invalid state transition table, such as a duplicate state or
+transition, a transition to an undefined state, or a nil hook. Event is only
+meaningful for errors in the definition of a transition. It satisfies the Error
+interface.
+*/
+type ErrInvalidDefinition struct {
+	State State
+	Event Event
+	msg   string
+}
+
+/*
+Error returns the error message assigned at struct creation.
+*/
+func (e *ErrInvalidDefinition) Error() string {
+	return e.msg
+}
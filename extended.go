@@ -0,0 +1,53 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+/*
+ExtendedState is a context value owned by a machine alongside its current state.
+It is passed to every extended guard and action, and is only updated by the
+values actions return. Clone must return an independent deep copy so that
+snapshots of a machine do not share data with the machine.
+*/
+type ExtendedState interface {
+	Clone() ExtendedState
+}
+
+/*
+TypedGuard adapts a guard for a concrete extended state type to an extended
+guard of a transition. The guard fails if the machine's extended state is not
+of the given type.
+*/
+func TypedGuard[T ExtendedState](guard func(s State, e Event, x T) bool) func(State, Event, ExtendedState) bool {
+	return func(s State, e Event, x ExtendedState) bool {
+		typed, ok := x.(T)
+
+		return ok && guard(s, e, typed)
+	}
+}
+
+/*
+TypedAction adapts an action for a concrete extended state type to an action of
+a transition. The action is skipped, leaving the extended state as it is, if the
+machine's extended state is not of the given type.
+*/
+func TypedAction[T ExtendedState](action func(s State, e Event, x T) T) func(State, Event, ExtendedState) ExtendedState {
+	return func(s State, e Event, x ExtendedState) ExtendedState {
+		typed, ok := x.(T)
+
+		if !ok {
+			return x
+		}
+
+		return action(s, e, typed)
+	}
+}
+
+func cloneExtended(x ExtendedState) ExtendedState {
+	if x == nil {
+		return nil
+	}
+
+	return x.Clone()
+}
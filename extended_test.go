@@ -0,0 +1,91 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+type counter struct {
+	count int
+}
+
+func (c *counter) Clone() cism.ExtendedState {
+	return &counter{c.count}
+}
+
+type other struct{}
+
+func (o *other) Clone() cism.ExtendedState {
+	return &other{}
+}
+
+func TestTypedGuard(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should fail when extended state type differs": shouldFailTypedGuardOtherType,
+		"should pass typed extended state to guard":    shouldPassTypedGuard,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestTypedAction(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should skip when extended state type differs": shouldSkipTypedActionOtherType,
+		"should return updated extended state":         shouldUpdateTypedAction,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldFailTypedGuardOtherType(t *testing.T, name string) {
+	guard := cism.TypedGuard(func(s cism.State, e cism.Event, c *counter) bool {
+		return true
+	})
+
+	if guard(cism.State(1), cism.Event(1), &other{}) {
+		t.Fail()
+		t.Logf("%s: guard passed", name)
+	}
+}
+
+func shouldPassTypedGuard(t *testing.T, name string) {
+	guard := cism.TypedGuard(func(s cism.State, e cism.Event, c *counter) bool {
+		return c.count == 1
+	})
+
+	if !guard(cism.State(1), cism.Event(1), &counter{1}) {
+		t.Fail()
+		t.Logf("%s: guard failed", name)
+	}
+}
+
+func shouldSkipTypedActionOtherType(t *testing.T, name string) {
+	ext := &other{}
+	action := cism.TypedAction(func(s cism.State, e cism.Event, c *counter) *counter {
+		return &counter{c.count + 1}
+	})
+
+	if action(cism.State(1), cism.Event(1), ext) != ext {
+		t.Fail()
+		t.Logf("%s: extended state changed", name)
+	}
+}
+
+func shouldUpdateTypedAction(t *testing.T, name string) {
+	action := cism.TypedAction(func(s cism.State, e cism.Event, c *counter) *counter {
+		return &counter{c.count + 1}
+	})
+
+	if c, ok := action(cism.State(1), cism.Event(1), &counter{1}).(*counter); !ok || c.count != 2 {
+		t.Fail()
+		t.Logf("%s: extended state not updated", name)
+	}
+}
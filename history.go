@@ -0,0 +1,132 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+type history struct {
+	limit int
+	recs  []HistoryRecord
+	seq   uint64
+	start int
+	total int
+}
+
+func (h *history) init(limit int) {
+	h.limit = limit
+
+	if limit > 0 && cap(h.recs) < limit {
+		h.recs = make([]HistoryRecord, 0, limit)
+	}
+}
+
+func (h *history) resize(limit int) {
+	h.linearize()
+
+	if limit > 0 && len(h.recs) > limit {
+		h.recs = h.recs[len(h.recs)-limit:]
+	}
+
+	h.limit = limit
+
+	if cap(h.recs) < limit {
+		h.recs = append(make([]HistoryRecord, 0, limit), h.recs...)
+	}
+}
+
+func (h *history) push(rec HistoryRecord) {
+	h.seq++
+	h.total++
+
+	if h.limit <= 0 || len(h.recs) < h.limit {
+		h.recs = append(h.recs, rec)
+
+		return
+	}
+
+	h.recs[h.start] = rec
+	h.start = (h.start + 1) % len(h.recs)
+}
+
+func (h *history) last() (HistoryRecord, bool) {
+	if len(h.recs) == 0 {
+		return HistoryRecord{}, false
+	}
+
+	return h.recs[(h.start+len(h.recs)-1)%len(h.recs)], true
+}
+
+func (h *history) len() int {
+	return len(h.recs)
+}
+
+func (h *history) at(i int) HistoryRecord {
+	return h.recs[(h.start+i)%len(h.recs)]
+}
+
+func (h *history) since(total int) []HistoryRecord {
+	n := h.total - total
+
+	if n > len(h.recs) {
+		n = len(h.recs)
+	}
+
+	if n <= 0 {
+		return nil
+	}
+
+	recs := make([]HistoryRecord, n)
+
+	for i := range recs {
+		recs[i] = h.at(len(h.recs) - n + i)
+	}
+
+	return recs
+}
+
+func (h *history) clone() history {
+	recs := make([]HistoryRecord, len(h.recs), max(h.limit, len(h.recs)))
+	n := copy(recs, h.recs[h.start:])
+
+	copy(recs[n:], h.recs[:h.start])
+
+	return history{h.limit, recs, h.seq, 0, h.total}
+}
+
+func (h *history) linearize() {
+	if h.start == 0 {
+		return
+	}
+
+	reverse(h.recs[:h.start])
+	reverse(h.recs[h.start:])
+	reverse(h.recs)
+
+	h.start = 0
+}
+
+func reverse(recs []HistoryRecord) {
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+}
+
+func (h *history) copy() []HistoryRecord {
+	cpyhist := make([]HistoryRecord, len(h.recs))
+	n := copy(cpyhist, h.recs[h.start:])
+
+	copy(cpyhist[n:], h.recs[:h.start])
+
+	return cpyhist
+}
+
+func (h *history) reset() {
+	h.start = 0
+	h.total = 0
+
+	if h.limit > 0 {
+		h.recs = h.recs[:0]
+	} else {
+		h.recs = nil
+	}
+}
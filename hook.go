@@ -0,0 +1,85 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "context"
+
+/*
+TransitionContext is the context of a transition passed to v2 lifecycle hooks.
+The context is only valid for the duration of the hook it is passed to.
+*/
+type TransitionContext struct {
+	Attempt  int             // times the event was sent in a row without a state change, starting at 1
+	Ctx      context.Context // context of the send that triggered the transition
+	Event    Event           // event that triggered the transition
+	Extended ExtendedState   // extended state of the machine, replaceable by success hooks
+	From     State           // state the transition starts from
+	Machine  View            // read-only view of the machine
+	Payload  interface{}     // payload sent with the event, if any
+	To       State           // state the transition goes to
+}
+
+/*
+HookFunc is the v2 signature of a transition lifecycle hook. A guard hook blocks
+the state change by returning an error. An error returned by any other hook is
+returned from Send wrapped in ErrHookFailed.
+*/
+type HookFunc func(tc *TransitionContext) error
+
+/*
+View is a read-only view of a machine.
+*/
+type View interface {
+	Current() State
+	CurrentExtended() ExtendedState
+	History() []HistoryRecord
+	Snapshot() Snapshot
+}
+
+type view struct {
+	m *Machine
+}
+
+func (v *view) Current() State {
+	return v.m.curr
+}
+
+func (v *view) CurrentExtended() ExtendedState {
+	return v.m.CurrentExtended()
+}
+
+func (v *view) History() []HistoryRecord {
+	return v.m.History()
+}
+
+func (v *view) Snapshot() Snapshot {
+	return v.m.Snapshot()
+}
+
+/*
+AdaptGuard adapts a guard with the original hook signature to the v2 hook
+signature. The adapted guard returns ErrGuardFailed when the guard fails.
+*/
+func AdaptGuard(guard func(s State, e Event) bool) HookFunc {
+	return func(tc *TransitionContext) error {
+		if !guard(tc.From, tc.Event) {
+			return &ErrGuardFailed{tc.From, tc.Event, "guard blocked state change"}
+		}
+
+		return nil
+	}
+}
+
+/*
+AdaptHook adapts a failure or success hook with the original hook signature to
+the v2 hook signature. The adapted hook never returns an error.
+*/
+func AdaptHook(hook func(s State, e Event)) HookFunc {
+	return func(tc *TransitionContext) error {
+		hook(tc.From, tc.Event)
+
+		return nil
+	}
+}
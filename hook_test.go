@@ -0,0 +1,69 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestAdaptGuard(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when guard fails":     shouldErrAdaptGuardFail,
+		"should be nil when guard passes": shouldSucceedAdaptGuard,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestAdaptHook(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should call hook with state and event": shouldSucceedAdaptHook,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldErrAdaptGuardFail(t *testing.T, name string) {
+	hook := cism.AdaptGuard(func(s cism.State, e cism.Event) bool {
+		return false
+	})
+	var hookErr *cism.ErrGuardFailed
+
+	if err := hook(&cism.TransitionContext{}); err == nil || err.Error() == "" || !errors.As(err, &hookErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldSucceedAdaptGuard(t *testing.T, name string) {
+	hook := cism.AdaptGuard(func(s cism.State, e cism.Event) bool {
+		return true
+	})
+
+	if err := hook(&cism.TransitionContext{}); err != nil {
+		t.Fail()
+		t.Logf("%s: errored", name)
+	}
+}
+
+func shouldSucceedAdaptHook(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	handled := false
+	hook := cism.AdaptHook(func(s cism.State, e cism.Event) {
+		handled = s == state && e == event
+	})
+
+	if err := hook(&cism.TransitionContext{Event: event, From: state}); err != nil || !handled {
+		t.Fail()
+		t.Logf("%s: hook not called", name)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"log"
+)
+
+/*
+Request is an event sent to a machine, as seen by interceptors before the
+machine looks up a transition for it.
+*/
+type Request struct {
+	Ctx     context.Context // context of the send
+	Event   Event           // event to send, which interceptors can rewrite
+	Payload interface{}     // payload of the send, which interceptors can rewrite
+	State   State           // current state of the machine when the event was sent
+	d       *delivery
+}
+
+/*
+Handler handles a request sent to a machine.
+*/
+type Handler func(req *Request) error
+
+/*
+Interceptor wraps the handler of the next interceptor in a machine's chain. An
+interceptor can observe or rewrite the request before calling next, or veto the
+request by returning an error without calling next.
+*/
+type Interceptor func(next Handler) Handler
+
+/*
+Use adds interceptors to the end of the machine's interceptor chain. The first
+interceptor added is the outermost, so it sees a request first and its result
+last. The innermost handler looks up and attempts the transition for the
+request. Interceptors only see events sent to the machine, not deferred events
+sent again or eventless transitions. Use must not be called while an event is
+being sent.
+*/
+func (m *Machine) Use(interceptors ...Interceptor) {
+	m.interceptors = append(m.interceptors, interceptors...)
+	chain := Handler(func(req *Request) error {
+		if req.Event == NoEvent {
+			return m.missing(m.curr, req.Event, "eventless transitions cannot be sent")
+		}
+
+		d := req.d
+
+		if d == nil {
+			d = &delivery{}
+		}
+
+		*d = delivery{ctx: req.Ctx, payload: req.Payload}
+
+		return m.dispatch(req.Event, d, false)
+	})
+
+	for i := len(m.interceptors) - 1; i >= 0; i-- {
+		chain = m.interceptors[i](chain)
+	}
+
+	m.chain = chain
+}
+
+/*
+Logging returns an interceptor that logs every request and its result with the
+given logger.
+*/
+func Logging(logger *log.Logger) Interceptor {
+	return func(next Handler) Handler {
+		return func(req *Request) error {
+			err := next(req)
+
+			if err != nil {
+				logger.Printf("cism: event %d in state %d failed: %v", req.Event, req.State, err)
+			} else {
+				logger.Printf("cism: event %d in state %d handled", req.Event, req.State)
+			}
+
+			return err
+		}
+	}
+}
+
+/*
+Recovery returns an interceptor that recovers from a panic in the rest of the
+chain, including lifecycle hooks, and returns it as ErrPanic. Hooks that
+panicked may have left the state change partially done.
+*/
+func Recovery() Interceptor {
+	return func(next Handler) Handler {
+		return func(req *Request) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = &ErrPanic{req.State, req.Event, v, "panic while handling event"}
+				}
+			}()
+
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sebuckler/cism"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestMachine_Use(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should run interceptors in order added": shouldRunInterceptorsInOrder,
+		"should veto event":                      shouldVetoInterceptor,
+		"should rewrite event":                   shouldRewriteInterceptor,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should log handled and failed events": shouldLogInterceptor,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when hook panics": shouldRecoverInterceptor,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func interceptedMachine() *cism.Machine {
+	return &cism.Machine{States: cism.StateTransitionTable{
+		cism.State(1): {
+			cism.Event(1): &cism.Transition{To: cism.State(2)},
+			cism.Event(2): &cism.Transition{To: cism.State(3)},
+			cism.Event(3): &cism.Transition{
+				OnSuccess: func(s cism.State, e cism.Event) {
+					panic("hook failed")
+				},
+				To: cism.State(2),
+			},
+		},
+		cism.State(2): {},
+		cism.State(3): {},
+	}}
+}
+
+func shouldRunInterceptorsInOrder(t *testing.T, name string) {
+	machine := interceptedMachine()
+	var order []string
+	record := func(id string) cism.Interceptor {
+		return func(next cism.Handler) cism.Handler {
+			return func(req *cism.Request) error {
+				order = append(order, id+" before")
+				err := next(req)
+				order = append(order, id+" after")
+
+				return err
+			}
+		}
+	}
+	machine.Use(record("first"))
+	machine.Use(record("second"))
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if strings.Join(order, ",") != "first before,second before,second after,first after" || startErr != nil ||
+		sendErr != nil || machine.Current() != cism.State(2) {
+		t.Fail()
+		t.Logf("%s: interceptors out of order", name)
+	}
+}
+
+func shouldVetoInterceptor(t *testing.T, name string) {
+	machine := interceptedMachine()
+	vetoErr := errors.New("not allowed")
+	machine.Use(func(next cism.Handler) cism.Handler {
+		return func(req *cism.Request) error {
+			if req.State == cism.State(1) && req.Event == cism.Event(1) {
+				return vetoErr
+			}
+
+			return next(req)
+		}
+	})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != vetoErr || startErr != nil || machine.Current() != cism.State(1) {
+		t.Fail()
+		t.Logf("%s: event not vetoed", name)
+	}
+}
+
+func shouldRewriteInterceptor(t *testing.T, name string) {
+	machine := interceptedMachine()
+	machine.Use(func(next cism.Handler) cism.Handler {
+		return func(req *cism.Request) error {
+			req.Event = cism.Event(2)
+
+			return next(req)
+		}
+	})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != nil || startErr != nil || machine.Current() != cism.State(3) {
+		t.Fail()
+		t.Logf("%s: event not rewritten", name)
+	}
+}
+
+func shouldLogInterceptor(t *testing.T, name string) {
+	machine := interceptedMachine()
+	var buf bytes.Buffer
+	machine.Use(cism.Logging(log.New(&buf, "", 0)))
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(4))
+	sendErr2 := machine.Send(cism.Event(1))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	if len(lines) != 2 || !strings.Contains(lines[0], "failed") || !strings.Contains(lines[1], "handled") ||
+		startErr != nil || sendErr == nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: events not logged", name)
+	}
+}
+
+func shouldRecoverInterceptor(t *testing.T, name string) {
+	machine := interceptedMachine()
+	machine.Use(cism.Recovery())
+	startErr := machine.Start(cism.State(1))
+	var machineErr *cism.ErrPanic
+
+	if err := machine.Send(cism.Event(3)); err == nil || err.Error() == "" || !errors.As(err, &machineErr) ||
+		machineErr.Value != "hook failed" || startErr != nil {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "context"
+
+/*
+Status represents the lifecycle state of a machine.
+*/
+type Status int
+
+const (
+	// NotStarted is the status of a machine that has not been started, or has been reset
+	NotStarted Status = iota
+	// Running is the status of a machine that has been started and accepts events
+	Running
+	// Paused is the status of a started machine that is holding its state until it is resumed
+	Paused
+	// Stopped is the status of a machine that was stopped by Stop and accepts no events until it is reset
+	Stopped
+	// Completed is the status of a machine that was stopped by a final transition
+	Completed
+)
+
+/*
+Status returns the machine's current lifecycle status. It reads the status the
+machine last published without locking, so it is safe to call from other
+goroutines while events are being sent.
+*/
+func (m *Machine) Status() Status {
+	return Status(m.pub.status.Load())
+}
+
+/*
+FinalEvent returns a copy of the last event the machine handled before it
+stopped. It returns nil if the machine has not stopped, or stopped before
+handling any event.
+*/
+func (m *Machine) FinalEvent() *Event {
+	if !m.done || m.endevt == nil {
+		return nil
+	}
+
+	e := *m.endevt
+
+	return &e
+}
+
+/*
+Done returns a channel that is closed when the machine stops, either by a final
+transition or by Stop. Use Status to tell the two apart. A machine that is reset
+returns a new channel that is closed the next time it stops.
+*/
+func (m *Machine) Done() <-chan struct{} {
+	m.donemu.Lock()
+	defer m.donemu.Unlock()
+
+	if m.donech == nil {
+		m.donech = make(chan struct{})
+	}
+
+	return m.donech
+}
+
+/*
+Wait blocks until the machine stops or the given context is done. It will
+return the context's error if the context is done first.
+*/
+func (m *Machine) Wait(ctx context.Context) error {
+	select {
+	case <-m.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
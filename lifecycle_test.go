@@ -0,0 +1,144 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"context"
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+	"time"
+)
+
+func TestMachine_Status(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should report stopped status":   shouldReportStopped,
+		"should report completed status": shouldReportCompleted,
+		"should report final event":      shouldReportFinalEvent,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_Wait(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should return when machine completes":  shouldWaitCompleted,
+		"should return context error":           shouldWaitCanceled,
+		"should renew done channel after reset": shouldRenewDone,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func finalTable() cism.StateTransitionTable {
+	stt := benchTable()
+	stt[cism.State(2)][cism.Event(3)] = &cism.Transition{IsFinal: true, To: cism.State(1)}
+
+	return stt
+}
+
+func shouldReportStopped(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	before := machine.Status()
+	startErr := machine.Start(cism.State(1))
+	running := machine.Status()
+	machine.Stop()
+	stopped := machine.Status()
+	resetErr := machine.Reset()
+
+	if before != cism.NotStarted || running != cism.Running || stopped != cism.Stopped ||
+		machine.Status() != cism.NotStarted || startErr != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: wrong statuses: %v %v %v", name, before, running, stopped)
+	}
+}
+
+func shouldReportCompleted(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(3))
+
+	if machine.Status() != cism.Completed || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: expected completed status, got %v", name, machine.Status())
+	}
+}
+
+func shouldReportFinalEvent(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	running := machine.FinalEvent()
+	sendErr2 := machine.Send(cism.Event(3))
+	final := machine.FinalEvent()
+	*final = cism.Event(9)
+
+	if running != nil || final == nil || *machine.FinalEvent() != cism.Event(3) || startErr != nil ||
+		sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: wrong final event", name)
+	}
+}
+
+func shouldWaitCompleted(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waited := make(chan error)
+
+	go func() {
+		waited <- machine.Wait(ctx)
+	}()
+
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(3))
+
+	if err := <-waited; err != nil || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: wait errored: %v", name, err)
+	}
+}
+
+func shouldWaitCanceled(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := machine.Wait(ctx)
+
+	if !errors.Is(err, context.DeadlineExceeded) || machine.Status() != cism.Running || startErr != nil {
+		t.Fail()
+		t.Logf("%s: expected deadline error, got %v", name, err)
+	}
+}
+
+func shouldRenewDone(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	machine.Stop()
+	done := machine.Done()
+	resetErr := machine.Reset()
+	renewed := machine.Done()
+	closed := false
+
+	select {
+	case <-renewed:
+		closed = true
+	default:
+	}
+
+	<-done
+
+	if closed || startErr != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: done channel not renewed", name)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+/*
+Names maps states and events to the names a machine uses in its log records. A
+state or event without a name is named after its value.
+*/
+type Names struct {
+	Events map[Event]string // names of events
+	States map[State]string // names of states
+}
+
+/*
+State returns the name of the given state.
+*/
+func (n *Names) State(s State) string {
+	if n != nil {
+		if name, ok := n.States[s]; ok {
+			return name
+		}
+	}
+
+	if s == AnyState {
+		return "AnyState"
+	}
+
+	return strconv.Itoa(int(s))
+}
+
+/*
+Event returns the name of the given event.
+*/
+func (n *Names) Event(e Event) string {
+	if n != nil {
+		if name, ok := n.Events[e]; ok {
+			return name
+		}
+	}
+
+	switch e {
+	case AnyEvent:
+		return "AnyEvent"
+	case NoEvent:
+		return "NoEvent"
+	}
+
+	return strconv.Itoa(int(e))
+}
+
+/*
+LogLevels determines the level of each kind of record a machine logs.
+*/
+type LogLevels struct {
+	Accepted  slog.Level // level for accepted transitions
+	Failed    slog.Level // level for sends that return an error other than ErrMissingTransition
+	Guard     slog.Level // level for guard results
+	Hook      slog.Level // level for hook durations
+	Lifecycle slog.Level // level for start, stop, and reset
+	Rejected  slog.Level // level for transitions with no passing guard
+	Send      slog.Level // level for sent events and unhandled events that are not errors
+	Unhandled slog.Level // level for unhandled events that return ErrMissingTransition
+}
+
+/*
+DefaultLogLevels returns the levels a machine logs with when it does not set its
+own. Accepted transitions, guard results, hook durations, and sent events are
+logged at debug, the lifecycle and rejected transitions at info, unhandled
+events at warn, and failed sends at error.
+*/
+func DefaultLogLevels() LogLevels {
+	return LogLevels{
+		Accepted:  slog.LevelDebug,
+		Failed:    slog.LevelError,
+		Guard:     slog.LevelDebug,
+		Hook:      slog.LevelDebug,
+		Lifecycle: slog.LevelInfo,
+		Rejected:  slog.LevelInfo,
+		Send:      slog.LevelDebug,
+		Unhandled: slog.LevelWarn,
+	}
+}
+
+func (m *Machine) levels() LogLevels {
+	if m.LogLevels != nil {
+		return *m.LogLevels
+	}
+
+	return DefaultLogLevels()
+}
+
+func (m *Machine) logs(ctx context.Context, level slog.Level) bool {
+	return m.Logger != nil && m.Logger.Enabled(ctx, level)
+}
+
+func (m *Machine) clock() time.Time {
+	if m.Logger == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+func (m *Machine) logLifecycle(msg string, s State, e Event) {
+	ctx := context.Background()
+	level := m.levels().Lifecycle
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, msg,
+			slog.String("state", m.Names.State(s)),
+			slog.String("event", m.Names.Event(e)))
+	}
+}
+
+func (m *Machine) logSend(ctx context.Context, e Event) {
+	level := m.levels().Send
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, "event sent",
+			slog.String("state", m.Names.State(m.curr)),
+			slog.String("event", m.Names.Event(e)))
+	}
+}
+
+func (m *Machine) logFailed(ctx context.Context, s State, e Event, err error) {
+	if _, ok := err.(*ErrMissingTransition); ok {
+		return
+	}
+
+	level := m.levels().Failed
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, "send failed",
+			slog.String("state", m.Names.State(s)),
+			slog.String("event", m.Names.Event(e)),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (m *Machine) logUnhandled(ctx context.Context, msg string, s State, e Event, missing bool) {
+	level := m.levels().Send
+
+	if missing {
+		level = m.levels().Unhandled
+	}
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, msg,
+			slog.String("state", m.Names.State(s)),
+			slog.String("event", m.Names.Event(e)))
+	}
+}
+
+func (m *Machine) logGuard(ctx context.Context, from State, to State, e Event, passed bool, start time.Time) {
+	level := m.levels().Guard
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, "guard evaluated",
+			slog.String("from", m.Names.State(from)),
+			slog.String("to", m.Names.State(to)),
+			slog.String("event", m.Names.Event(e)),
+			slog.Bool("passed", passed),
+			slog.Duration("duration", time.Since(start)))
+	}
+}
+
+func (m *Machine) logTransition(ctx context.Context, msg string, from State, to State, e Event, accepted bool) {
+	level := m.levels().Rejected
+
+	if accepted {
+		level = m.levels().Accepted
+	}
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, msg,
+			slog.String("from", m.Names.State(from)),
+			slog.String("to", m.Names.State(to)),
+			slog.String("event", m.Names.Event(e)))
+	}
+}
+
+func (m *Machine) logHook(ctx context.Context, hook string, s State, e Event, start time.Time) {
+	level := m.levels().Hook
+
+	if m.logs(ctx, level) {
+		m.Logger.LogAttrs(ctx, level, "hook finished",
+			slog.String("hook", hook),
+			slog.String("state", m.Names.State(s)),
+			slog.String("event", m.Names.Event(e)),
+			slog.Duration("duration", time.Since(start)))
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"bytes"
+	"github.com/sebuckler/cism"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestMachine_Logger(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should log lifecycle and transitions": shouldLogTransitions,
+		"should log guard results":             shouldLogGuards,
+		"should log hook durations":            shouldLogHooks,
+		"should warn for missing transition":   shouldWarnUnhandled,
+		"should log with custom levels":        shouldLogCustomLevels,
+		"should not log without logger":        shouldNotLogWithoutLogger,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestNames(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should name states and events": shouldNameStatesAndEvents,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func loggedMachine(buf *bytes.Buffer, level slog.Level) *cism.Machine {
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})
+
+	return &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{
+			cism.State(2): {OnEnter: func(s cism.State, e cism.Event) {}},
+		},
+		Logger: slog.New(handler),
+		Names: &cism.Names{
+			Events: map[cism.Event]string{cism.Event(1): "Begin", cism.Event(2): "Finish"},
+			States: map[cism.State]string{cism.State(1): "Idle", cism.State(2): "Working", cism.State(3): "Done"},
+		},
+		States: cism.StateTransitionTable{
+			cism.State(1): {
+				cism.Event(1): &cism.Transition{
+					Guard:     func(s cism.State, e cism.Event) bool { return true },
+					OnSuccess: func(s cism.State, e cism.Event) {},
+					To:        cism.State(2),
+				},
+			},
+			cism.State(2): {
+				cism.Event(1): &cism.Transition{
+					Guard: func(s cism.State, e cism.Event) bool { return false },
+					To:    cism.State(3),
+				},
+				cism.Event(2): &cism.Transition{IsFinal: true, To: cism.State(3)},
+			},
+			cism.State(3): {},
+		},
+	}
+}
+
+func shouldLogTransitions(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelDebug)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	resetErr := machine.Reset()
+	out := buf.String()
+	expected := []string{
+		`level=INFO msg="machine started" state=Idle event=NoEvent`,
+		`level=DEBUG msg="event sent" state=Idle event=Begin`,
+		`level=DEBUG msg="state changed" from=Idle to=Working event=Begin`,
+		`level=DEBUG msg="state changed" from=Working to=Done event=Finish`,
+		`level=INFO msg="machine stopped" state=Done event=Finish`,
+		`level=INFO msg="machine reset" state=Idle event=NoEvent`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Fail()
+			t.Logf("%s: missing log record %s", name, line)
+		}
+	}
+
+	if startErr != nil || sendErr != nil || sendErr2 != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: machine errored", name)
+	}
+}
+
+func shouldLogGuards(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelDebug)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+	out := buf.String()
+
+	if !strings.Contains(out, `msg="guard evaluated" from=Idle to=Working event=Begin passed=true`) ||
+		!strings.Contains(out, `msg="guard evaluated" from=Working to=Done event=Begin passed=false`) ||
+		!strings.Contains(out, `level=INFO msg="transition rejected" from=Working to=Done event=Begin`) ||
+		startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: guard results not logged", name)
+	}
+}
+
+func shouldLogHooks(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelDebug)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	out := buf.String()
+
+	if !strings.Contains(out, `msg="hook finished" hook=OnSuccess state=Idle event=Begin`) ||
+		!strings.Contains(out, `msg="hook finished" hook=OnEnter state=Working event=Begin`) ||
+		startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: hook durations not logged", name)
+	}
+}
+
+func shouldWarnUnhandled(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelWarn)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	out := strings.TrimSpace(buf.String())
+
+	if out != `level=WARN msg="event unhandled" state=Idle event=Finish` || startErr != nil || sendErr == nil {
+		t.Fail()
+		t.Logf("%s: missing transition not warned: %s", name, out)
+	}
+}
+
+func shouldLogCustomLevels(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelInfo)
+	levels := cism.DefaultLogLevels()
+	levels.Accepted = slog.LevelInfo
+	levels.Lifecycle = slog.LevelDebug
+	machine.LogLevels = &levels
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	out := strings.TrimSpace(buf.String())
+
+	if out != `level=INFO msg="state changed" from=Idle to=Working event=Begin` || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: custom levels not used: %s", name, out)
+	}
+}
+
+func shouldNotLogWithoutLogger(t *testing.T, name string) {
+	var buf bytes.Buffer
+	machine := loggedMachine(&buf, slog.LevelDebug)
+	machine.Logger = nil
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if buf.Len() != 0 || startErr != nil || sendErr != nil || machine.Current() != cism.State(2) {
+		t.Fail()
+		t.Logf("%s: logged without logger", name)
+	}
+}
+
+func shouldNameStatesAndEvents(t *testing.T, name string) {
+	names := &cism.Names{States: map[cism.State]string{cism.State(1): "Idle"}}
+	var unnamed *cism.Names
+
+	if names.State(cism.State(1)) != "Idle" || names.State(cism.State(2)) != "2" ||
+		names.Event(cism.Event(3)) != "3" || unnamed.State(cism.AnyState) != "AnyState" ||
+		unnamed.Event(cism.AnyEvent) != "AnyEvent" || unnamed.Event(cism.NoEvent) != "NoEvent" {
+		t.Fail()
+		t.Logf("%s: states and events not named", name)
+	}
+}
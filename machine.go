@@ -4,44 +4,134 @@
 
 package cism
 
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 /*
 HistoryRecord represents a past state change and the event that caused it.
 */
 type HistoryRecord struct {
-	State State // state that was transitioned to
-	Event Event // event that triggered the state change
+	State  State          // state that was transitioned from
+	Event  Event          // event that triggered the state change
+	To     State          // state that was transitioned to
+	Branch int            // index of the branch taken, or -1 if the transition has no branches
+	Kind   TransitionKind // kind of transition that was taken
+}
+
+/*
+DefaultMaxEventless is the limit of eventless transitions a machine takes in a
+row before returning ErrEventlessLoop, when the machine does not set a limit.
+*/
+const DefaultMaxEventless = 100
+
+/*
+DeadLetter represents an event that was sent to a machine and never handled.
+*/
+type DeadLetter struct {
+	State State // state the machine was in when the event was dropped
+	Event Event // event that had no transition
+}
+
+/*
+Snapshot represents a point-in-time copy of a machine.
+*/
+type Snapshot struct {
+	State    State           // state the machine was in
+	Extended ExtendedState   // clone of the machine's extended state
+	History  []HistoryRecord // copy of the machine's history log
 }
 
 /*
 Machine is a state machine driven by a state transition table. All state
-transitions are managed by the state machine.
+transitions are managed by the state machine. A machine must not be copied after
+first use. Events must not be sent to a machine from more than one goroutine at
+a time, but Current and Position can be read from any goroutine.
 */
 type Machine struct {
-	States  StateTransitionTable // states and events the machine uses for transitions
-	curr    State
-	done    bool
-	endevt  *Event
-	hist    []HistoryRecord
-	initial State
-	started bool
+	Compiled     *CompiledTable         // compiled table the machine uses in place of States, if any
+	Configs      map[State]*StateConfig // per-state behavior overriding the machine's behavior
+	Extended     ExtendedState          // initial extended state, cloned when the machine starts or resets
+	HistoryLimit int                    // limit of records kept in a preallocated history log, unbounded if 0
+	LogLevels    *LogLevels             // levels of the machine's log records, defaults to DefaultLogLevels
+	Logger       *slog.Logger           // logger for structured records of the machine's activity, if any
+	MaxEventless int                    // limit of chained eventless transitions, defaults to DefaultMaxEventless
+	Metrics      MetricsSink            // sink for measurements of the machine's transitions, if any
+	Names        *Names                 // names of states and events used in log records
+	OnUnhandled  func(s State, e Event) // hook for unhandled events when policy is UnhandledHook
+	ProbeGuards  bool                   // evaluates guards in Can and AvailableEvents if true
+	Profiling    bool                   // wraps transitions in trace regions and labels hooks for pprof if true
+	ReuseErrors  bool                   // returns reused error values for failed sends if true
+	States       StateTransitionTable   // states and events the machine uses for transitions
+	Tracer       Tracer                 // tracer for spans around the machine's sends, if any
+	Unhandled    UnhandledPolicy        // policy for events with no transition, defaults to UnhandledError
+	WhilePaused  PausePolicy            // policy for events sent while paused, defaults to PauseReject
+	archive      [][]HistoryRecord
+	attemptevt   Event
+	chain        Handler
+	attempts     int
+	changed      bool
+	completed    bool
+	curr         State
+	dead         []DeadLetter
+	deferred     []pending
+	done         bool
+	donech       chan struct{}
+	donemu       sync.Mutex
+	endevt       *Event
+	endval       Event
+	entered      time.Time
+	errmissing   ErrMissingTransition
+	errnotstart  ErrMachineNotStarted
+	errstopped   ErrMachineStopped
+	ext          ExtendedState
+	hist         history
+	initial      State
+	interceptors []Interceptor
+	obs          atomic.Value
+	obsmu        sync.Mutex
+	paused       bool
+	pausedat     time.Time
+	pub          publication
+	queued       []pending
+	redispatched bool
+	redo         []HistoryRecord
+	resend       bool
+	sim          *SimulateOptions
+	started      bool
+	undofloor    int
+	viewer       *view
 }
 
 /*
 Start will start the machine at the given state. It will return an error if the
 state transition table was not set on the machine. It will return an error if
-the given state does not exist in the state transition table. It will return an
-error if the machine has been stopped. It will return an error if the machine
-has already been started.
+the given state does not exist in the state transition table or is a
+pseudo-state. It will return an error if the machine has been stopped. It will
+return an error if the machine has already been started. The extended state will
+be set to a clone of the machine's initial extended state. The entry hook of the
+given state will be invoked with NoEvent, and then eventless transitions will be
+taken until the machine reaches a stable state. It will return an error if the
+eventless transitions exceed the machine's limit, in which case the machine
+stays started in the state it reached.
 */
 func (m *Machine) Start(s State) error {
-	if len(m.States) == 0 {
+	if len(m.States) == 0 && m.Compiled == nil {
 		return &ErrMissingStates{"no states set"}
 	}
 
-	if _, ok := m.States[s]; !ok {
+	if !m.defined(s) || s == AnyState {
 		return &ErrStateNotDefined{s, "start state not defined in states"}
 	}
 
+	if m.pseudo(s) != RealState {
+		return &ErrStateNotDefined{s, "start state is a pseudo-state"}
+	}
+
 	if m.done {
 		return &ErrMachineStopped{m.endevt, "machine is done and cannot be started"}
 	}
@@ -50,113 +140,346 @@ func (m *Machine) Start(s State) error {
 		return &ErrMachineStarted{"machine has already started"}
 	}
 
+	m.completed = false
 	m.curr = s
 	m.done = false
+	m.ext = cloneExtended(m.Extended)
 	m.initial = s
+	m.paused = false
+	m.queued = nil
+	m.redo = nil
+	m.resend = false
 	m.started = true
+	m.undofloor = 0
 
-	return nil
+	m.hist.init(m.HistoryLimit)
+	m.publish()
+
+	d := delivery{ctx: context.Background()}
+
+	if m.Metrics != nil {
+		m.entered = time.Now()
+	}
+
+	m.logLifecycle("machine started", s, NoEvent)
+	m.enter(s, NoEvent, &d)
+	m.emit(MachineStarted, s, s, NoEvent)
+
+	err := m.complete(s, &d)
+
+	m.publish()
+
+	return err
 }
 
 /*
 Send will attempt to begin a state change based on the given event and the
 current state. It will return an error if the machine has not been started. It
-will return an error if the machine has been stopped. It will return an error
-if no transition is defined for the given event and current state. The
-transition lifecycle hooks will be invoked to determine if the machine can
+will return an error if the machine has been stopped.
+
+If no transition is defined for the given event and current state, the
+unhandled event policy of the current state, or of the machine, is applied.
+Under the default policy, it will return an error. Ignored events are pushed
+into a dead letter log. Deferred events are sent again, in order, after the next
+state change.
+
+The transition lifecycle hooks will be invoked to determine if the machine can
 complete the state change. If the transition guard fails, a failed state change
 handler will be invoked. If the transition guard passes, a successful state
-change handler will be invoked. If the transition is marked as final, the
-machine will be stopped after the state change. If the state change succeeds,
-the current history and triggering event will be pushed into a history log.
+change handler will be invoked. If the transition defines branches, the first
+branch whose guard passes is taken, and the failed state change handler is only
+invoked if no branch passes. It will return an error if a v2 lifecycle hook
+returns an error.
+
+An external transition invokes the exit hook of the current state before the
+state change and the entry hook of the next state after the successful state
+change handler, even if both states are the same. An internal transition
+invokes the successful state change handler without leaving the current state.
+If the transition is marked as final, the machine will be stopped after the
+state change. If the state change succeeds, the current state, triggering event,
+next state, and taken branch will be pushed into a history log.
+
+Before the transition is looked up, the event is passed through the machine's
+interceptor chain, and it will return the error of an interceptor that vetoes
+the event.
+
+If the next state is a junction, the junction's branches are resolved before the
+state change, and a junction without a passing branch fails the transition.
+After an external transition, the eventless transitions of the next state will
+be taken until the machine reaches a stable state. It will return an error if
+the eventless transitions exceed the machine's limit. If the eventless
+transitions end in a choice without a passing branch, the machine returns to the
+last state it rested in and it will return an error.
 */
 func (m *Machine) Send(e Event) error {
-	if !m.started {
-		return &ErrMachineNotStarted{"machine has not started"}
-	}
-
-	if m.done {
-		return &ErrMachineStopped{m.endevt, "machine is done and not accepting transitions"}
-	}
+	return m.send(context.Background(), e, nil)
+}
 
-	if tran := m.States.GetTransition(m.curr, e); tran != nil {
-		m.transition(tran, e)
-	} else {
-		return &ErrMissingTransition{m.curr, e, "no transition found for event in current state"}
-	}
+/*
+SendContext will attempt to begin a state change based on the given event and
+the current state, exactly like Send. The given context is passed to v2
+lifecycle hooks in their transition context. It will return an error wrapping
+the context's error if the context is done before the state change, in which
+case no state change or failed state change handler occurs. Once the state
+changes, the context is no longer checked, so the state change and the
+eventless transitions that follow it are all taken and the machine stays in a
+stable state.
+*/
+func (m *Machine) SendContext(ctx context.Context, e Event) error {
+	return m.send(ctx, e, nil)
+}
 
-	return nil
+/*
+SendPayload will attempt to begin a state change based on the given event and
+the current state, exactly like Send. The given payload is passed to v2
+lifecycle hooks in their transition context. A deferred event keeps its payload
+when it is sent again.
+*/
+func (m *Machine) SendPayload(e Event, payload interface{}) error {
+	return m.send(context.Background(), e, payload)
 }
 
 /*
-Stop marks the machine as stopped and will accept no more state changes.
+Stop marks the machine as stopped and will accept no more state changes. Events
+queued while the machine was paused are dropped into the dead letter log.
 */
 func (m *Machine) Stop() {
-	m.stop()
+	m.stop(false)
 }
 
 /*
 Reset marks the machine as not stopped and not started. It will return an error
-if the machine has not been stopped. The history log will be cleared on a
-successful reset. The machine can be started again after it has been reset.
+if the machine has not been stopped. The history log, history archive, dead
+letter log, deferred events, and queued events will be cleared, and the extended
+state will be reset to a clone of the machine's initial extended state on a
+successful reset. The machine can be started again after it has been reset. Use
+ResetTo or Restart to reset a running machine, or to keep its history log.
 */
 func (m *Machine) Reset() error {
 	if !m.done {
 		return &ErrMachineNotStopped{"machine has not stopped"}
 	}
 
+	from := m.curr
+
+	m.archive = nil
+	m.completed = false
+	m.dead = nil
+	m.deferred = nil
 	m.done = false
 	m.endevt = nil
-	m.hist = nil
+	m.ext = cloneExtended(m.Extended)
+	m.hist.reset()
 	m.curr = m.initial
+	m.paused = false
+	m.queued = nil
+	m.redo = nil
+	m.resend = false
 	m.started = false
+	m.undofloor = 0
+
+	m.donemu.Lock()
+	m.donech = nil
+	m.donemu.Unlock()
+	m.publish()
+	m.logLifecycle("machine reset", m.curr, NoEvent)
+	m.emit(MachineReset, from, m.curr, NoEvent)
 
 	return nil
 }
 
 /*
-Current returns the current state the machine is in.
+Current returns the current state the machine is in. It reads the state without
+locking, so it is safe to call from other goroutines while events are being
+sent. It is updated as soon as the machine enters a real state, so a hook sees
+the state its transition went to, but it never reports a pseudo-state.
 */
 func (m *Machine) Current() State {
-	return m.curr
+	return State(m.pub.curr.Load())
 }
 
 /*
-History returns a copy of the machine's state change history log.
+History returns a copy of the machine's state change history log. If the
+machine has a history limit, only the most recent records are kept.
 */
 func (m *Machine) History() []HistoryRecord {
-	cpyhist := make([]HistoryRecord, len(m.hist))
+	return m.hist.copy()
+}
 
-	copy(cpyhist, m.hist)
+/*
+CurrentExtended returns a clone of the machine's current extended state.
+*/
+func (m *Machine) CurrentExtended() ExtendedState {
+	return cloneExtended(m.ext)
+}
 
-	return cpyhist
+/*
+Snapshot returns a copy of the machine's current state, extended state, and
+history log. Any modification to the snapshot will not affect the machine.
+*/
+func (m *Machine) Snapshot() Snapshot {
+	return Snapshot{m.curr, cloneExtended(m.ext), m.History()}
 }
 
-func (m *Machine) transition(tran *Transition, e Event) {
-	currstate := m.curr
+/*
+Validate checks the machine's pseudo-states against its state transition table.
+It will return an error if a pseudo-state is not defined in the table or has no
+eventless transition. It will return an error if a choice has no default branch
+and could leave the machine stuck in the choice.
+*/
+func (m *Machine) Validate() error {
+	for s, conf := range m.Configs {
+		if conf == nil || conf.Pseudo == RealState {
+			continue
+		}
+
+		if !m.defined(s) {
+			return &ErrInvalidPseudoState{s, "pseudo-state not defined in states"}
+		}
 
-	if tran.Guard == nil || tran.Guard(currstate, e) {
-		m.hist = append(m.hist, HistoryRecord{currstate, e})
-		m.curr = tran.To
+		tran := m.lookup(s, NoEvent)
 
-		if tran.OnSuccess != nil {
-			tran.OnSuccess(currstate, e)
+		if tran == nil {
+			return &ErrInvalidPseudoState{s, "pseudo-state has no eventless transition"}
 		}
 
-		if tran.IsFinal {
-			m.stop()
+		if conf.Pseudo == ChoiceState && !tran.hasDefault() {
+			return &ErrInvalidPseudoState{s, "choice has no default branch"}
 		}
-	} else if tran.OnFail != nil {
-		tran.OnFail(currstate, e)
 	}
+
+	return nil
+}
+
+/*
+DeadLetters returns a copy of the machine's log of events that were never
+handled.
+*/
+func (m *Machine) DeadLetters() []DeadLetter {
+	cpydead := make([]DeadLetter, len(m.dead))
+
+	copy(cpydead, m.dead)
+
+	return cpydead
+}
+
+/*
+Deferred returns a copy of the events waiting to be sent again after the next
+state change.
+*/
+func (m *Machine) Deferred() []Event {
+	cpydeferred := make([]Event, len(m.deferred))
+
+	for i, p := range m.deferred {
+		cpydeferred[i] = p.event
+	}
+
+	return cpydeferred
 }
 
-func (m *Machine) stop() {
-	histlen := len(m.hist)
+func (m *Machine) send(ctx context.Context, e Event, payload interface{}) error {
+	if ok, err := m.admit(ctx, e, payload); !ok {
+		return err
+	}
+
+	from := m.curr
+	d := delivery{ctx: ctx, payload: payload}
+	var span Span
+	var err error
+
+	m.logSend(ctx, e)
 
-	if histlen > 0 {
-		m.endevt = &(m.hist[histlen-1].Event)
+	if m.Tracer != nil {
+		_, span = m.startSpan(&d, SendSpan, from, e)
 	}
 
+	if m.chain != nil {
+		chained := d
+		err = m.chain(&Request{d.ctx, e, payload, m.curr, &chained})
+		d = chained
+	} else {
+		err = m.dispatch(e, &d, false)
+	}
+
+	if err != nil && m.Logger != nil {
+		m.logFailed(ctx, from, e, err)
+	}
+
+	if span != nil {
+		m.endSend(span, &d, err)
+	}
+
+	return err
+}
+
+func (m *Machine) admit(ctx context.Context, e Event, payload interface{}) (bool, error) {
+	if !m.started {
+		return false, m.notStarted()
+	}
+
+	if m.done {
+		return false, m.stopped()
+	}
+
+	if e == NoEvent {
+		return false, m.missing(m.curr, e, "eventless transitions cannot be sent")
+	}
+
+	if m.paused {
+		return false, m.hold(e, payload)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, &ErrCanceled{m.curr, e, err, "send canceled before state change"}
+	}
+
+	return true, nil
+}
+
+func (m *Machine) stop(completed bool) {
+	if m.done {
+		return
+	}
+
+	endevt := NoEvent
+
+	if last, ok := m.hist.last(); ok {
+		endevt = last.Event
+		m.endval = endevt
+		m.endevt = &m.endval
+	}
+
+	m.completed = completed
 	m.done = true
+
+	m.drop()
+	m.publish()
+	m.logLifecycle("machine stopped", m.curr, endevt)
+	m.emit(MachineStopped, m.curr, m.curr, endevt)
+	m.donemu.Lock()
+
+	if m.donech == nil {
+		m.donech = make(chan struct{})
+	}
+
+	close(m.donech)
+	m.donemu.Unlock()
+}
+
+func (m *Machine) lookup(s State, e Event) *Transition {
+	if m.Compiled != nil {
+		return m.Compiled.GetTransition(s, e)
+	}
+
+	return m.States.GetTransition(s, e)
+}
+
+func (m *Machine) defined(s State) bool {
+	if m.Compiled != nil {
+		return m.Compiled.HasState(s)
+	}
+
+	_, ok := m.States[s]
+
+	return ok
 }
@@ -5,8 +5,10 @@
 package cism_test
 
 import (
+	"context"
 	"errors"
 	"github.com/sebuckler/cism"
+	"strings"
 	"testing"
 )
 
@@ -14,9 +16,13 @@ func TestMachine_Start(t *testing.T) {
 	testCases := map[string]func(t *testing.T, name string){
 		"should err when states missing":          shouldErrStartStatesMissing,
 		"should err when state not defined":       shouldErrStartStateNotDefined,
+		"should err when state is wildcard":       shouldErrStartAnyState,
+		"should err when state is pseudo-state":   shouldErrStartPseudoState,
 		"should err when machine stopped":         shouldErrStartMachineStopped,
 		"should err when machine already started": shouldErrStartMachineStarted,
 		"should be nil when successful":           shouldSucceedStart,
+		"should enter start state":                shouldEnterStartState,
+		"should take eventless transitions":       shouldStartEventless,
 	}
 
 	for name, test := range testCases {
@@ -26,13 +32,65 @@ func TestMachine_Start(t *testing.T) {
 
 func TestMachine_Send(t *testing.T) {
 	testCases := map[string]func(t *testing.T, name string){
-		"should err when machine not started":                shouldErrSendMachineNotStarted,
-		"should err when machine stopped":                    shouldErrSendMachineStopped,
-		"should err when no transition for event":            shouldErrSendNoTran,
-		"should be nil when transition successful":           shouldSucceedSend,
-		"should stop machine when transition final":          shouldStopMachineFinalTran,
-		"should handle failed transition when guard fails":   shouldHandleTranGuardFail,
-		"should handle success transition when guard passes": shouldHandleTranGuardPass,
+		"should err when machine not started":                 shouldErrSendMachineNotStarted,
+		"should err when machine stopped":                     shouldErrSendMachineStopped,
+		"should err when no transition for event":             shouldErrSendNoTran,
+		"should be nil when transition successful":            shouldSucceedSend,
+		"should stop machine when transition final":           shouldStopMachineFinalTran,
+		"should handle failed transition when guard fails":    shouldHandleTranGuardFail,
+		"should handle success transition when guard passes":  shouldHandleTranGuardPass,
+		"should take first branch when guards pass":           shouldTakeFirstPassingBranch,
+		"should take default branch when guards fail":         shouldTakeDefaultBranch,
+		"should handle failed transition when no branch":      shouldHandleTranNoBranchPass,
+		"should dead letter unhandled event when ignored":     shouldIgnoreUnhandled,
+		"should send deferred event after state change":       shouldDeferUnhandled,
+		"should route unhandled event to hook":                shouldRouteUnhandledHook,
+		"should prefer state policy over machine policy":      shouldPreferStateUnhandledPolicy,
+		"should exit and enter on self transition":            shouldExitEnterSelfTran,
+		"should not exit or enter on internal transition":     shouldNotExitEnterInternalTran,
+		"should chain eventless transitions until stable":     shouldChainEventless,
+		"should not reject failed eventless guard":            shouldNotRejectEventless,
+		"should err when eventless transitions loop":          shouldErrEventlessLoop,
+		"should err when sending no event":                    shouldErrSendNoEvent,
+		"should pass through choice":                          shouldPassThroughChoice,
+		"should err and return when choice stuck":             shouldErrChoiceStuck,
+		"should roll back stuck choice":                       shouldRollBackChoiceStuck,
+		"should stop after final choice settles":              shouldStopFinalChoice,
+		"should pass through junction":                        shouldPassThroughJunction,
+		"should handle failed transition when junction fails": shouldHandleTranJunctionFail,
+		"should update extended state with action":            shouldUpdateExtendedAction,
+		"should guard with extended state":                    shouldGuardExtended,
+		"should pass transition context to v2 hooks":          shouldPassContextV2,
+		"should handle failed transition when v2 guard errs":  shouldHandleTranGuardV2Fail,
+		"should err when v2 success hook errs":                shouldErrSuccessV2,
+		"should count attempts without state change":          shouldCountAttemptsV2,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_Validate(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when pseudo-state not defined":      shouldErrValidatePseudoNotDefined,
+		"should err when pseudo-state has no eventless": shouldErrValidatePseudoNoEventless,
+		"should err when choice has no default branch":  shouldErrValidateChoiceNoDefault,
+		"should be nil when pseudo-states valid":        shouldSucceedValidate,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_SendContext(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when context done before send":     shouldErrSendContextDone,
+		"should abort when context done in guard":      shouldAbortSendContextGuard,
+		"should pass context to hooks":                 shouldPassSendContext,
+		"should finish eventless when context done":    shouldFinishEventlessContextDone,
+		"should pass through choice when context done": shouldPassChoiceContextDone,
 	}
 
 	for name, test := range testCases {
@@ -45,6 +103,7 @@ func TestMachine_Reset(t *testing.T) {
 		"should err when machine not stopped": shouldErrResetMachineNotStopped,
 		"should be nil when reset successful": shouldSucceedReset,
 		"should start after reset":            shouldResetThenStart,
+		"should reset extended state":         shouldResetExtended,
 	}
 
 	for name, test := range testCases {
@@ -62,10 +121,23 @@ func TestMachine_Current(t *testing.T) {
 	}
 }
 
+func TestMachine_Snapshot(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should include state and history": shouldSucceedSnapshot,
+		"should not share extended state":  shouldCloneExtendedSnapshot,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
 func TestMachine_History(t *testing.T) {
 	testCases := map[string]func(t *testing.T, name string){
 		"should be empty when no transitions occurred": shouldBeEmptyHistoryNoTran,
 		"should have correct transition history":       shouldSucceedHistory,
+		"should record taken branch":                   shouldRecordBranchHistory,
+		"should record transition kind":                shouldRecordKindHistory,
 	}
 
 	for name, test := range testCases {
@@ -95,6 +167,30 @@ func shouldErrStartStateNotDefined(t *testing.T, name string) {
 	}
 }
 
+func shouldErrStartAnyState(t *testing.T, name string) {
+	machine := &cism.Machine{States: cism.StateTransitionTable{cism.AnyState: nil}}
+	var machineErr *cism.ErrStateNotDefined
+
+	if err := machine.Start(cism.AnyState); err == nil || !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldErrStartPseudoState(t *testing.T, name string) {
+	state := cism.State(1)
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{state: {Pseudo: cism.ChoiceState}},
+		States:  cism.StateTransitionTable{state: nil},
+	}
+	var machineErr *cism.ErrStateNotDefined
+
+	if err := machine.Start(state); err == nil || !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
 func shouldErrStartMachineStopped(t *testing.T, name string) {
 	state := cism.State(1)
 	machine := &cism.Machine{States: cism.StateTransitionTable{state: nil}}
@@ -129,6 +225,36 @@ func shouldSucceedStart(t *testing.T, name string) {
 	}
 }
 
+func shouldEnterStartState(t *testing.T, name string) {
+	state := cism.State(1)
+	entered := false
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{state: {OnEnter: func(s cism.State, e cism.Event) {
+			entered = s == state && e == cism.NoEvent
+		}}},
+		States: cism.StateTransitionTable{state: nil},
+	}
+
+	if err := machine.Start(state); err != nil || !entered {
+		t.Fail()
+		t.Logf("%s: start state not entered", name)
+	}
+}
+
+func shouldStartEventless(t *testing.T, name string) {
+	state := cism.State(1)
+	state2 := cism.State(2)
+	machine := &cism.Machine{States: cism.StateTransitionTable{
+		state:  {cism.NoEvent: &cism.Transition{To: state2}},
+		state2: {},
+	}}
+
+	if err := machine.Start(state); err != nil || machine.Current() != state2 {
+		t.Fail()
+		t.Logf("%s: eventless transition not taken", name)
+	}
+}
+
 func shouldErrSendMachineNotStarted(t *testing.T, name string) {
 	event := cism.Event(1)
 	machine := &cism.Machine{}
@@ -236,6 +362,761 @@ func shouldHandleTranGuardPass(t *testing.T, name string) {
 	}
 }
 
+func shouldTakeFirstPassingBranch(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	handled := false
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		Branches: []*cism.Transition{
+			{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return true
+				},
+				OnSuccess: func(s cism.State, e cism.Event) {
+					handled = true
+				},
+				To: state2,
+			},
+			{To: state3},
+		},
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.Send(event); err != nil || startErr != nil || !handled || machine.Current() != state2 {
+		t.Fail()
+		t.Logf("%s: first passing branch not taken", name)
+	}
+}
+
+func shouldTakeDefaultBranch(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		Branches: []*cism.Transition{
+			{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				To: state2,
+			},
+			{To: state3},
+		},
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.Send(event); err != nil || startErr != nil || machine.Current() != state3 {
+		t.Fail()
+		t.Logf("%s: default branch not taken", name)
+	}
+}
+
+func shouldHandleTranNoBranchPass(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	handled := false
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		Branches: []*cism.Transition{
+			{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				To: state2,
+			},
+		},
+		OnFail: func(s cism.State, e cism.Event) {
+			handled = true
+		},
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.Send(event); err != nil || startErr != nil || !handled || machine.Current() != state {
+		t.Fail()
+		t.Logf("%s: failed transition not handled", name)
+	}
+}
+
+func shouldIgnoreUnhandled(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {}}, Unhandled: cism.UnhandledIgnore}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	dead := machine.DeadLetters()
+
+	if len(dead) != 1 || dead[0].Event != event || dead[0].State != state || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: event not dead lettered", name)
+	}
+}
+
+func shouldDeferUnhandled(t *testing.T, name string) {
+	event := cism.Event(1)
+	event2 := cism.Event(2)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	machine := &cism.Machine{
+		States: cism.StateTransitionTable{
+			state:  {event2: &cism.Transition{To: state2}},
+			state2: {event: &cism.Transition{To: state3}},
+			state3: {},
+		},
+		Unhandled: cism.UnhandledDefer,
+	}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	deferred := machine.Deferred()
+	sendErr2 := machine.Send(event2)
+
+	if len(deferred) != 1 || len(machine.Deferred()) != 0 || machine.Current() != state3 || startErr != nil ||
+		sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: deferred event not sent", name)
+	}
+}
+
+func shouldRouteUnhandledHook(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	handled := false
+	machine := &cism.Machine{
+		OnUnhandled: func(s cism.State, e cism.Event) {
+			handled = s == state && e == event
+		},
+		States:    cism.StateTransitionTable{state: {}},
+		Unhandled: cism.UnhandledHook,
+	}
+	startErr := machine.Start(state)
+
+	if err := machine.Send(event); err != nil || startErr != nil || !handled || len(machine.DeadLetters()) != 0 {
+		t.Fail()
+		t.Logf("%s: unhandled event not routed", name)
+	}
+}
+
+func shouldPreferStateUnhandledPolicy(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	machine := &cism.Machine{
+		Configs:   map[cism.State]*cism.StateConfig{state: {Unhandled: cism.UnhandledError}},
+		States:    cism.StateTransitionTable{state: {}},
+		Unhandled: cism.UnhandledIgnore,
+	}
+	startErr := machine.Start(state)
+	var machineErr *cism.ErrMissingTransition
+
+	if err := machine.Send(event); err == nil || !errors.As(err, &machineErr) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: state policy not used", name)
+	}
+}
+
+func shouldExitEnterSelfTran(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	var hooks []string
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{state: {
+			OnEnter: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "enter")
+			},
+			OnExit: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "exit")
+			},
+		}},
+		States: cism.StateTransitionTable{state: {event: &cism.Transition{
+			OnSuccess: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "success")
+			},
+			To: state,
+		}}},
+	}
+	startErr := machine.Start(state)
+	hooks = nil
+
+	if err := machine.Send(event); err != nil || startErr != nil || len(hooks) != 3 || hooks[0] != "exit" ||
+		hooks[1] != "success" || hooks[2] != "enter" {
+		t.Fail()
+		t.Logf("%s: state not exited and entered", name)
+	}
+}
+
+func shouldNotExitEnterInternalTran(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	var hooks []string
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{state: {
+			OnEnter: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "enter")
+			},
+			OnExit: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "exit")
+			},
+		}},
+		States: cism.StateTransitionTable{state: {event: &cism.Transition{
+			Internal: true,
+			OnSuccess: func(s cism.State, e cism.Event) {
+				hooks = append(hooks, "success")
+			},
+			To: state2,
+		}}},
+	}
+	startErr := machine.Start(state)
+	hooks = nil
+
+	if err := machine.Send(event); err != nil || startErr != nil || len(hooks) != 1 || hooks[0] != "success" ||
+		machine.Current() != state {
+		t.Fail()
+		t.Logf("%s: state exited or entered", name)
+	}
+}
+
+func shouldChainEventless(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	state4 := cism.State(4)
+	machine := &cism.Machine{States: cism.StateTransitionTable{
+		state: {event: &cism.Transition{To: state2}},
+		state2: {cism.NoEvent: &cism.Transition{Branches: []*cism.Transition{
+			{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				To: state4,
+			},
+			{To: state3},
+		}}},
+		state3: {cism.NoEvent: &cism.Transition{
+			Guard: func(s cism.State, e cism.Event) bool {
+				return false
+			},
+			To: state4,
+		}},
+		state4: {},
+	}}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	hist := machine.History()
+
+	if machine.Current() != state3 || len(hist) != 2 || hist[1].Event != cism.NoEvent || startErr != nil ||
+		sendErr != nil {
+		t.Fail()
+		t.Logf("%s: eventless transitions not chained", name)
+	}
+}
+
+func shouldNotRejectEventless(t *testing.T, name string) {
+	failed := false
+	collector := &cism.Collector{}
+	machine := &cism.Machine{
+		Metrics: collector,
+		States: cism.StateTransitionTable{
+			cism.State(1): {cism.Event(1): &cism.Transition{To: cism.State(2)}},
+			cism.State(2): {cism.NoEvent: &cism.Transition{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				OnFail: func(s cism.State, e cism.Event) {
+					failed = true
+				},
+				To: cism.State(3),
+			}},
+			cism.State(3): {},
+		},
+	}
+	rejected := false
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		rejected = rejected || ev.Kind == cism.TransitionRejected
+	})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if machine.Current() != cism.State(2) || failed || rejected || len(collector.Stats().Rejections) != 0 ||
+		startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: failed eventless guard rejected", name)
+	}
+}
+
+func shouldErrEventlessLoop(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	machine := &cism.Machine{
+		MaxEventless: 10,
+		States: cism.StateTransitionTable{
+			state:  {event: &cism.Transition{To: state2}},
+			state2: {cism.NoEvent: &cism.Transition{To: state3}},
+			state3: {cism.NoEvent: &cism.Transition{To: state2}},
+		},
+	}
+	startErr := machine.Start(state)
+	var machineErr *cism.ErrEventlessLoop
+
+	if err := machine.Send(event); err == nil || err.Error() == "" || !errors.As(err, &machineErr) ||
+		machineErr.Limit != 10 || len(machine.History()) != 11 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldErrSendNoEvent(t *testing.T, name string) {
+	state := cism.State(1)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {}}}
+	startErr := machine.Start(state)
+	var machineErr *cism.ErrMissingTransition
+
+	if err := machine.Send(cism.NoEvent); err == nil || !errors.As(err, &machineErr) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func choiceMachine(choice cism.PseudoKind, guard func(s cism.State, e cism.Event) bool,
+	onSuccess func(s cism.State, e cism.Event)) *cism.Machine {
+	return &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{cism.State(2): {Pseudo: choice}},
+		States: cism.StateTransitionTable{
+			cism.State(1): {cism.Event(1): &cism.Transition{OnSuccess: onSuccess, To: cism.State(2)}},
+			cism.State(2): {cism.NoEvent: &cism.Transition{Branches: []*cism.Transition{
+				{Guard: guard, To: cism.State(3)},
+			}}},
+			cism.State(3): {},
+		},
+	}
+}
+
+func shouldPassThroughChoice(t *testing.T, name string) {
+	ready := false
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return ready
+	}, func(s cism.State, e cism.Event) {
+		ready = true
+	})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != nil || startErr != nil || machine.Current() != cism.State(3) ||
+		len(machine.History()) != 2 {
+		t.Fail()
+		t.Logf("%s: choice not passed through", name)
+	}
+}
+
+func shouldErrChoiceStuck(t *testing.T, name string) {
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return false
+	}, nil)
+	startErr := machine.Start(cism.State(1))
+	var machineErr *cism.ErrChoiceStuck
+
+	if err := machine.Send(cism.Event(1)); err == nil || err.Error() == "" || !errors.As(err, &machineErr) ||
+		startErr != nil || machine.Current() != cism.State(1) || len(machine.History()) != 2 {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldRollBackChoiceStuck(t *testing.T, name string) {
+	var calls []string
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return false
+	}, nil)
+	hook := recorder(&calls)
+	machine.Configs[cism.State(1)] = &cism.StateConfig{OnEnter: hook("enter"), OnExit: hook("exit")}
+	var events []cism.TransitionEvent
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		events = append(events, ev)
+	})
+	startErr := machine.Start(cism.State(1))
+	calls = nil
+	events = nil
+	err := machine.Send(cism.Event(1))
+	hist := machine.History()
+	undoErr := machine.Undo()
+
+	accepted := cism.TransitionEvent{Kind: cism.TransitionAccepted, From: cism.State(1), To: cism.State(2),
+		Event: cism.Event(1)}
+	rolledBack := cism.TransitionEvent{Kind: cism.TransitionRolledBack, From: cism.State(2), To: cism.State(1),
+		Event: cism.NoEvent}
+	rollback := cism.HistoryRecord{State: cism.State(2), Event: cism.NoEvent, To: cism.State(1), Branch: -1,
+		Kind: cism.RollbackTransition}
+
+	if err == nil || startErr != nil || undoErr == nil || machine.Current() != cism.State(1) ||
+		strings.Join(calls, ",") != "exit,enter" || len(events) != 2 || events[0] != accepted ||
+		events[1] != rolledBack || len(hist) != 2 || hist[0].To != cism.State(2) || hist[1] != rollback {
+		t.Fail()
+		t.Logf("%s: choice not rolled back: %v %v %v", name, calls, events, hist)
+	}
+}
+
+func shouldStopFinalChoice(t *testing.T, name string) {
+	passes := false
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return passes
+	}, nil)
+	machine.States[cism.State(1)][cism.Event(1)].IsFinal = true
+	entered := 0
+	machine.Configs[cism.State(1)] = &cism.StateConfig{OnEnter: func(s cism.State, e cism.Event) {
+		entered++
+	}}
+	startErr := machine.Start(cism.State(1))
+	err := machine.Send(cism.Event(1))
+	status := machine.Status()
+	passes = true
+	err2 := machine.Send(cism.Event(1))
+	var machineErr *cism.ErrChoiceStuck
+
+	if !errors.As(err, &machineErr) || status != cism.Running || entered != 2 || err2 != nil ||
+		machine.Status() != cism.Completed || machine.Current() != cism.State(3) || len(machine.History()) != 4 ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: final choice not settled before stop: %v %v %v", name, err, status, machine.History())
+	}
+}
+
+func shouldPassThroughJunction(t *testing.T, name string) {
+	machine := choiceMachine(cism.JunctionState, func(s cism.State, e cism.Event) bool {
+		return true
+	}, nil)
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != nil || startErr != nil || machine.Current() != cism.State(3) ||
+		len(machine.History()) != 2 {
+		t.Fail()
+		t.Logf("%s: junction not passed through", name)
+	}
+}
+
+func shouldHandleTranJunctionFail(t *testing.T, name string) {
+	succeeded := false
+	machine := choiceMachine(cism.JunctionState, func(s cism.State, e cism.Event) bool {
+		return false
+	}, func(s cism.State, e cism.Event) {
+		succeeded = true
+	})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != nil || startErr != nil || succeeded ||
+		machine.Current() != cism.State(1) || len(machine.History()) != 0 {
+		t.Fail()
+		t.Logf("%s: failed junction not succeeded", name)
+	}
+}
+
+func shouldErrValidatePseudoNotDefined(t *testing.T, name string) {
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{cism.State(2): {Pseudo: cism.JunctionState}},
+		States:  cism.StateTransitionTable{cism.State(1): {}},
+	}
+	var machineErr *cism.ErrInvalidPseudoState
+
+	if err := machine.Validate(); err == nil || err.Error() == "" || !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldErrValidatePseudoNoEventless(t *testing.T, name string) {
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{cism.State(1): {Pseudo: cism.JunctionState}},
+		States:  cism.StateTransitionTable{cism.State(1): {cism.Event(1): &cism.Transition{}}},
+	}
+	var machineErr *cism.ErrInvalidPseudoState
+
+	if err := machine.Validate(); err == nil || !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldErrValidateChoiceNoDefault(t *testing.T, name string) {
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return true
+	}, nil)
+	var machineErr *cism.ErrInvalidPseudoState
+
+	if err := machine.Validate(); err == nil || !errors.As(err, &machineErr) || machineErr.State != cism.State(2) {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldSucceedValidate(t *testing.T, name string) {
+	machine := choiceMachine(cism.ChoiceState, nil, nil)
+
+	if err := machine.Validate(); err != nil {
+		t.Fail()
+		t.Logf("%s: errored", name)
+	}
+}
+
+func extendedMachine() *cism.Machine {
+	return &cism.Machine{
+		Extended: &counter{},
+		States: cism.StateTransitionTable{
+			cism.State(1): {cism.Event(1): &cism.Transition{
+				Action: cism.TypedAction(func(s cism.State, e cism.Event, c *counter) *counter {
+					return &counter{c.count + 1}
+				}),
+				Internal: true,
+			}, cism.Event(2): &cism.Transition{
+				ExtGuard: cism.TypedGuard(func(s cism.State, e cism.Event, c *counter) bool {
+					return c.count > 1
+				}),
+				IsFinal: true,
+				To:      cism.State(2),
+			}},
+			cism.State(2): {},
+		},
+	}
+}
+
+func shouldUpdateExtendedAction(t *testing.T, name string) {
+	machine := extendedMachine()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	ext, ok := machine.CurrentExtended().(*counter)
+
+	if !ok || ext.count != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: extended state not updated", name)
+	}
+}
+
+func shouldGuardExtended(t *testing.T, name string) {
+	machine := extendedMachine()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	blocked := machine.Current() == cism.State(1)
+	sendErr3 := machine.Send(cism.Event(1))
+	sendErr4 := machine.Send(cism.Event(2))
+
+	if !blocked || machine.Current() != cism.State(2) || startErr != nil || sendErr != nil || sendErr2 != nil ||
+		sendErr3 != nil || sendErr4 != nil {
+		t.Fail()
+		t.Logf("%s: extended state not guarded", name)
+	}
+}
+
+func shouldPassContextV2(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	var got cism.TransitionContext
+	machine := &cism.Machine{
+		Extended: &counter{},
+		States: cism.StateTransitionTable{state: {event: &cism.Transition{
+			OnSuccessV2: func(tc *cism.TransitionContext) error {
+				got = *tc
+				tc.Extended = &counter{7}
+
+				return nil
+			},
+			To: state2,
+		}}, state2: {}},
+	}
+	startErr := machine.Start(state)
+	sendErr := machine.SendPayload(event, "payload")
+	ext, ok := machine.CurrentExtended().(*counter)
+
+	if got.From != state || got.To != state2 || got.Event != event || got.Payload != "payload" ||
+		got.Attempt != 1 || got.Ctx == nil || got.Machine == nil || got.Machine.Current() != state2 || !ok ||
+		ext.count != 7 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: transition context incorrect", name)
+	}
+}
+
+func shouldHandleTranGuardV2Fail(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	handled := false
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		GuardV2: func(tc *cism.TransitionContext) error {
+			return errors.New("blocked")
+		},
+		OnFailV2: func(tc *cism.TransitionContext) error {
+			handled = true
+
+			return nil
+		},
+		To: cism.State(2),
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.Send(event); err != nil || startErr != nil || !handled || machine.Current() != state {
+		t.Fail()
+		t.Logf("%s: failed transition not handled", name)
+	}
+}
+
+func shouldErrSuccessV2(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	hookErr := errors.New("failed")
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		OnSuccessV2: func(tc *cism.TransitionContext) error {
+			return hookErr
+		},
+		To: state2,
+	}}, state2: {}}}
+	startErr := machine.Start(state)
+	var machineErr *cism.ErrHookFailed
+
+	if err := machine.Send(event); err == nil || err.Error() == "" || !errors.As(err, &machineErr) ||
+		!errors.Is(err, hookErr) || machine.Current() != state2 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldCountAttemptsV2(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	var attempts []int
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		GuardV2: func(tc *cism.TransitionContext) error {
+			attempts = append(attempts, tc.Attempt)
+
+			if tc.Attempt < 3 {
+				return errors.New("not yet")
+			}
+
+			return nil
+		},
+		To: state,
+	}}}}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	sendErr2 := machine.Send(event)
+	sendErr3 := machine.Send(event)
+	sendErr4 := machine.Send(event)
+
+	if len(attempts) != 4 || attempts[2] != 3 || attempts[3] != 1 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil || sendErr3 != nil || sendErr4 != nil {
+		t.Fail()
+		t.Logf("%s: attempts not counted", name)
+	}
+}
+
+func shouldErrSendContextDone(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{To: cism.State(2)}}}}
+	startErr := machine.Start(state)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var machineErr *cism.ErrCanceled
+
+	if err := machine.SendContext(ctx, event); err == nil || err.Error() == "" || !errors.As(err, &machineErr) ||
+		!errors.Is(err, context.Canceled) || machine.Current() != state || startErr != nil {
+		t.Fail()
+		t.Logf("%s: did not error correctly", name)
+	}
+}
+
+func shouldAbortSendContextGuard(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := false
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		Guard: func(s cism.State, e cism.Event) bool {
+			cancel()
+
+			return true
+		},
+		OnFail: func(s cism.State, e cism.Event) {
+			handled = true
+		},
+		OnSuccess: func(s cism.State, e cism.Event) {
+			handled = true
+		},
+		To: cism.State(2),
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.SendContext(ctx, event); !errors.Is(err, context.Canceled) || handled ||
+		machine.Current() != state || len(machine.History()) != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: send not aborted", name)
+	}
+}
+
+func shouldPassSendContext(t *testing.T, name string) {
+	type key struct{}
+	event := cism.Event(1)
+	state := cism.State(1)
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	var got interface{}
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		GuardV2: func(tc *cism.TransitionContext) error {
+			got = tc.Ctx.Value(key{})
+
+			return nil
+		},
+		To: state,
+	}}}}
+	startErr := machine.Start(state)
+
+	if err := machine.SendContext(ctx, event); err != nil || got != "value" || startErr != nil {
+		t.Fail()
+		t.Logf("%s: context not passed", name)
+	}
+}
+
+func shouldPassChoiceContextDone(t *testing.T, name string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return true
+	}, func(s cism.State, e cism.Event) {
+		cancel()
+	})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.SendContext(ctx, cism.Event(1)); err != nil || machine.Current() != cism.State(3) ||
+		len(machine.History()) != 2 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: choice not passed through: %v", name, err)
+	}
+}
+
+func shouldFinishEventlessContextDone(t *testing.T, name string) {
+	event := cism.Event(1)
+	state := cism.State(1)
+	state2 := cism.State(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	machine := &cism.Machine{States: cism.StateTransitionTable{
+		state: {event: &cism.Transition{
+			OnSuccess: func(s cism.State, e cism.Event) {
+				cancel()
+			},
+			To: state2,
+		}},
+		state2:        {cism.NoEvent: &cism.Transition{To: cism.State(3)}},
+		cism.State(3): {},
+	}}
+	startErr := machine.Start(state)
+
+	if err := machine.SendContext(ctx, event); err != nil || machine.Current() != cism.State(3) ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: eventless transition not taken: %v", name, err)
+	}
+}
+
 func shouldErrResetMachineNotStopped(t *testing.T, name string) {
 	state := cism.State(1)
 	machine := &cism.Machine{States: cism.StateTransitionTable{state: nil}}
@@ -313,3 +1194,88 @@ func shouldSucceedHistory(t *testing.T, name string) {
 		t.Logf("%s: no history", name)
 	}
 }
+
+func shouldRecordBranchHistory(t *testing.T, name string) {
+	state := cism.State(1)
+	state2 := cism.State(2)
+	state3 := cism.State(3)
+	event := cism.Event(1)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {event: &cism.Transition{
+		Branches: []*cism.Transition{
+			{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				To: state2,
+			},
+			{To: state3},
+		},
+	}}}}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	hist := machine.History()
+
+	if len(hist) != 1 || hist[0].Branch != 1 || hist[0].To != state3 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: branch not recorded", name)
+	}
+}
+
+func shouldRecordKindHistory(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	event2 := cism.Event(2)
+	machine := &cism.Machine{States: cism.StateTransitionTable{state: {
+		event:  &cism.Transition{To: state},
+		event2: &cism.Transition{Internal: true},
+	}}}
+	startErr := machine.Start(state)
+	sendErr := machine.Send(event)
+	sendErr2 := machine.Send(event2)
+	hist := machine.History()
+
+	if len(hist) != 2 || hist[0].Kind != cism.ExternalTransition || hist[1].Kind != cism.InternalTransition ||
+		startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: kind not recorded", name)
+	}
+}
+
+func shouldResetExtended(t *testing.T, name string) {
+	machine := extendedMachine()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	machine.Stop()
+	resetErr := machine.Reset()
+	ext, ok := machine.CurrentExtended().(*counter)
+
+	if !ok || ext.count != 0 || startErr != nil || sendErr != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: extended state not reset", name)
+	}
+}
+
+func shouldSucceedSnapshot(t *testing.T, name string) {
+	machine := extendedMachine()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	snap := machine.Snapshot()
+
+	if snap.State != cism.State(1) || len(snap.History) != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: snapshot incorrect", name)
+	}
+}
+
+func shouldCloneExtendedSnapshot(t *testing.T, name string) {
+	machine := extendedMachine()
+	startErr := machine.Start(cism.State(1))
+	snap := machine.Snapshot()
+	snap.Extended.(*counter).count = 5
+	ext, ok := machine.CurrentExtended().(*counter)
+
+	if !ok || ext.count != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: extended state shared", name)
+	}
+}
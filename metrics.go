@@ -0,0 +1,331 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/*
+MetricsSink receives the measurements a machine takes while it sends events.
+Implement it to forward measurements to a metrics backend. A sink shared by
+machines that send events from other goroutines must be safe for concurrent use.
+*/
+type MetricsSink interface {
+	Transition(from State, e Event, to State) // called for every accepted transition
+	Rejected(s State, e Event)                // called for every transition with no passing guard
+	Unhandled(s State, e Event)               // called for every event with no transition, under any policy
+	Dwell(s State, d time.Duration)           // called with the time spent in a state when it is exited
+}
+
+/*
+MultiSink returns a sink that forwards every measurement to each of the given
+sinks in order, such as a collector for one machine and a collector shared by
+many.
+*/
+func MultiSink(sinks ...MetricsSink) MetricsSink {
+	return multiSink(sinks)
+}
+
+type multiSink []MetricsSink
+
+func (ms multiSink) Transition(from State, e Event, to State) {
+	for _, sink := range ms {
+		sink.Transition(from, e, to)
+	}
+}
+
+func (ms multiSink) Rejected(s State, e Event) {
+	for _, sink := range ms {
+		sink.Rejected(s, e)
+	}
+}
+
+func (ms multiSink) Unhandled(s State, e Event) {
+	for _, sink := range ms {
+		sink.Unhandled(s, e)
+	}
+}
+
+func (ms multiSink) Dwell(s State, d time.Duration) {
+	for _, sink := range ms {
+		sink.Dwell(s, d)
+	}
+}
+
+/*
+TransitionKey identifies an accepted transition by its from state, event, and to
+state.
+*/
+type TransitionKey struct {
+	From  State // state that was transitioned from
+	Event Event // event that triggered the transition
+	To    State // state that was transitioned to
+}
+
+/*
+EventKey identifies an event sent in a state.
+*/
+type EventKey struct {
+	State State // state the event was sent in
+	Event Event // event that was sent
+}
+
+/*
+Histogram is a distribution of durations over buckets with upper bounds.
+*/
+type Histogram struct {
+	Bounds []time.Duration // inclusive upper bounds of the buckets, in ascending order
+	Counts []uint64        // counts of each bucket, with one more bucket for durations above the last bound
+	Count  uint64          // count of all durations
+	Sum    time.Duration   // sum of all durations
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h Histogram) copy() Histogram {
+	cpyhist := Histogram{Bounds: make([]time.Duration, len(h.Bounds)), Counts: make([]uint64, len(h.Counts))}
+	cpyhist.Count = h.Count
+	cpyhist.Sum = h.Sum
+
+	copy(cpyhist.Bounds, h.Bounds)
+	copy(cpyhist.Counts, h.Counts)
+
+	return cpyhist
+}
+
+/*
+Stats is a point-in-time copy of the statistics taken by a collector.
+*/
+type Stats struct {
+	Dwell       map[State]Histogram      // time spent in each state before it was exited
+	Rejections  map[EventKey]uint64      // counts of transitions with no passing guard
+	Transitions map[TransitionKey]uint64 // counts of accepted transitions
+	Unhandled   map[EventKey]uint64      // counts of events with no transition
+}
+
+/*
+RejectionRate returns the share of transitions for the given state and event
+that had no passing guard, or 0 if none were attempted.
+*/
+func (st Stats) RejectionRate(s State, e Event) float64 {
+	rejected := st.Rejections[EventKey{s, e}]
+	attempted := rejected
+
+	for key, count := range st.Transitions {
+		if key.From == s && key.Event == e {
+			attempted += count
+		}
+	}
+
+	if attempted == 0 {
+		return 0
+	}
+
+	return float64(rejected) / float64(attempted)
+}
+
+/*
+DefaultBuckets returns the upper bounds of the dwell time histograms of a
+collector that does not set its own.
+*/
+func DefaultBuckets() []time.Duration {
+	return []time.Duration{
+		time.Millisecond,
+		10 * time.Millisecond,
+		100 * time.Millisecond,
+		time.Second,
+		10 * time.Second,
+		time.Minute,
+		10 * time.Minute,
+		time.Hour,
+	}
+}
+
+/*
+Collector is a metrics sink that keeps statistics in memory. A collector can be
+set on one machine for per-machine statistics, or shared by many machines for
+aggregated statistics, and is safe for concurrent use. A collector is an
+expvar.Var, so it can be published with expvar.Publish, and its Names are used
+for the states and events in its published statistics.
+*/
+type Collector struct {
+	Buckets     []time.Duration // upper bounds of dwell time histograms, defaults to DefaultBuckets
+	Names       *Names          // names of states and events used when published
+	dwell       map[State]*Histogram
+	mu          sync.Mutex
+	rejections  map[EventKey]uint64
+	transitions map[TransitionKey]uint64
+	unhandled   map[EventKey]uint64
+}
+
+/*
+Transition counts an accepted transition.
+*/
+func (c *Collector) Transition(from State, e Event, to State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transitions == nil {
+		c.transitions = map[TransitionKey]uint64{}
+	}
+
+	c.transitions[TransitionKey{from, e, to}]++
+}
+
+/*
+Rejected counts a transition with no passing guard.
+*/
+func (c *Collector) Rejected(s State, e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rejections == nil {
+		c.rejections = map[EventKey]uint64{}
+	}
+
+	c.rejections[EventKey{s, e}]++
+}
+
+/*
+Unhandled counts an event with no transition.
+*/
+func (c *Collector) Unhandled(s State, e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.unhandled == nil {
+		c.unhandled = map[EventKey]uint64{}
+	}
+
+	c.unhandled[EventKey{s, e}]++
+}
+
+/*
+Dwell adds the time spent in a state to the state's histogram.
+*/
+func (c *Collector) Dwell(s State, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dwell == nil {
+		c.dwell = map[State]*Histogram{}
+	}
+
+	hist := c.dwell[s]
+
+	if hist == nil {
+		bounds := c.Buckets
+
+		if len(bounds) == 0 {
+			bounds = DefaultBuckets()
+		}
+
+		hist = &Histogram{Bounds: append([]time.Duration(nil), bounds...), Counts: make([]uint64, len(bounds)+1)}
+		c.dwell[s] = hist
+	}
+
+	hist.observe(d)
+}
+
+/*
+Stats returns a copy of the collector's statistics.
+*/
+func (c *Collector) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Dwell:       make(map[State]Histogram, len(c.dwell)),
+		Rejections:  make(map[EventKey]uint64, len(c.rejections)),
+		Transitions: make(map[TransitionKey]uint64, len(c.transitions)),
+		Unhandled:   make(map[EventKey]uint64, len(c.unhandled)),
+	}
+
+	for s, hist := range c.dwell {
+		stats.Dwell[s] = hist.copy()
+	}
+
+	for key, count := range c.rejections {
+		stats.Rejections[key] = count
+	}
+
+	for key, count := range c.transitions {
+		stats.Transitions[key] = count
+	}
+
+	for key, count := range c.unhandled {
+		stats.Unhandled[key] = count
+	}
+
+	return stats
+}
+
+/*
+String returns the collector's statistics as JSON, keyed by the names of states
+and events, so a collector can be published with expvar.
+*/
+func (c *Collector) String() string {
+	stats := c.Stats()
+	dwell := make(map[string]interface{}, len(stats.Dwell))
+	rejections := make(map[string]uint64, len(stats.Rejections))
+	transitions := make(map[string]uint64, len(stats.Transitions))
+	unhandled := make(map[string]uint64, len(stats.Unhandled))
+
+	for s, hist := range stats.Dwell {
+		buckets := make(map[string]uint64, len(hist.Counts))
+
+		for i, count := range hist.Counts {
+			if i < len(hist.Bounds) {
+				buckets[hist.Bounds[i].String()] = count
+			} else {
+				buckets["+Inf"] = count
+			}
+		}
+
+		dwell[c.Names.State(s)] = map[string]interface{}{
+			"buckets": buckets,
+			"count":   hist.Count,
+			"sum":     hist.Sum.Seconds(),
+		}
+	}
+
+	for key, count := range stats.Rejections {
+		rejections[c.Names.State(key.State)+"/"+c.Names.Event(key.Event)] = count
+	}
+
+	for key, count := range stats.Transitions {
+		transitions[c.Names.State(key.From)+"/"+c.Names.Event(key.Event)+"/"+c.Names.State(key.To)] = count
+	}
+
+	for key, count := range stats.Unhandled {
+		unhandled[c.Names.State(key.State)+"/"+c.Names.Event(key.Event)] = count
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"dwell":       dwell,
+		"rejections":  rejections,
+		"transitions": transitions,
+		"unhandled":   unhandled,
+	})
+
+	if err != nil {
+		return "{}"
+	}
+
+	return string(out)
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/sebuckler/cism"
+	"testing"
+	"time"
+)
+
+func TestMachine_Metrics(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should count transitions":         shouldCountTransitions,
+		"should count rejections":          shouldCountRejections,
+		"should count unhandled events":    shouldCountUnhandled,
+		"should record dwell time on exit": shouldRecordDwell,
+		"should aggregate across machines": shouldAggregateMetrics,
+		"should forward to multiple sinks": shouldForwardMultiSink,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should bucket dwell times": shouldBucketDwell,
+		"should encode as expvar":   shouldEncodeExpvar,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func measuredMachine(sink cism.MetricsSink) *cism.Machine {
+	return &cism.Machine{
+		Metrics: sink,
+		States: cism.StateTransitionTable{
+			cism.State(1): {
+				cism.Event(1): &cism.Transition{To: cism.State(2)},
+				cism.Event(2): &cism.Transition{Internal: true},
+			},
+			cism.State(2): {
+				cism.Event(1): &cism.Transition{
+					Guard: func(s cism.State, e cism.Event) bool { return false },
+					To:    cism.State(1),
+				},
+				cism.Event(2): &cism.Transition{To: cism.State(1)},
+			},
+		},
+	}
+}
+
+func shouldCountTransitions(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	machine := measuredMachine(collector)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(2))
+	sendErr4 := machine.Send(cism.Event(1))
+	stats := collector.Stats()
+
+	if stats.Transitions[cism.TransitionKey{From: cism.State(1), Event: cism.Event(1), To: cism.State(2)}] != 2 ||
+		stats.Transitions[cism.TransitionKey{From: cism.State(2), Event: cism.Event(2), To: cism.State(1)}] != 1 ||
+		stats.Transitions[cism.TransitionKey{From: cism.State(1), Event: cism.Event(2), To: cism.State(1)}] != 1 ||
+		startErr != nil || sendErr != nil || sendErr2 != nil || sendErr3 != nil || sendErr4 != nil {
+		t.Fail()
+		t.Logf("%s: transitions not counted: %v", name, stats.Transitions)
+	}
+}
+
+func shouldCountRejections(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	machine := measuredMachine(collector)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+	sendErr3 := machine.Send(cism.Event(2))
+	sendErr4 := machine.Send(cism.Event(1))
+	sendErr5 := machine.Send(cism.Event(1))
+	stats := collector.Stats()
+
+	if stats.Rejections[cism.EventKey{State: cism.State(2), Event: cism.Event(1)}] != 2 ||
+		stats.RejectionRate(cism.State(2), cism.Event(1)) != 1 || stats.RejectionRate(cism.State(1), cism.Event(1)) != 0 ||
+		stats.RejectionRate(cism.State(3), cism.Event(1)) != 0 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil || sendErr3 != nil || sendErr4 != nil || sendErr5 != nil {
+		t.Fail()
+		t.Logf("%s: rejections not counted: %v", name, stats.Rejections)
+	}
+}
+
+func shouldCountUnhandled(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	machine := measuredMachine(collector)
+	machine.Unhandled = cism.UnhandledIgnore
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(3))
+	sendErr2 := machine.Send(cism.Event(3))
+	stats := collector.Stats()
+
+	if stats.Unhandled[cism.EventKey{State: cism.State(1), Event: cism.Event(3)}] != 2 || startErr != nil ||
+		sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: unhandled events not counted: %v", name, stats.Unhandled)
+	}
+}
+
+func shouldRecordDwell(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	machine := measuredMachine(collector)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	dwellInternal := collector.Stats().Dwell[cism.State(1)].Count
+	sendErr2 := machine.Send(cism.Event(1))
+	stats := collector.Stats()
+
+	if stats.Dwell[cism.State(1)].Count != 1 || stats.Dwell[cism.State(2)].Count != 0 || dwellInternal != 0 ||
+		len(stats.Dwell[cism.State(1)].Counts) != len(cism.DefaultBuckets())+1 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: dwell time not recorded: %v", name, stats.Dwell)
+	}
+}
+
+func shouldAggregateMetrics(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	machine := measuredMachine(collector)
+	machine2 := measuredMachine(collector)
+	startErr := machine.Start(cism.State(1))
+	startErr2 := machine2.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine2.Send(cism.Event(1))
+	stats := collector.Stats()
+
+	if stats.Transitions[cism.TransitionKey{From: cism.State(1), Event: cism.Event(1), To: cism.State(2)}] != 2 ||
+		startErr != nil || startErr2 != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: metrics not aggregated", name)
+	}
+}
+
+func shouldForwardMultiSink(t *testing.T, name string) {
+	collector := &cism.Collector{}
+	shared := &cism.Collector{}
+	machine := measuredMachine(cism.MultiSink(collector, shared))
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+	sendErr3 := machine.Send(cism.Event(3))
+
+	for _, stats := range []cism.Stats{collector.Stats(), shared.Stats()} {
+		if len(stats.Transitions) != 1 || len(stats.Rejections) != 1 || len(stats.Unhandled) != 1 ||
+			len(stats.Dwell) != 1 || startErr != nil || sendErr != nil || sendErr2 != nil || sendErr3 == nil {
+			t.Fail()
+			t.Logf("%s: measurements not forwarded", name)
+		}
+	}
+}
+
+func shouldBucketDwell(t *testing.T, name string) {
+	collector := &cism.Collector{Buckets: []time.Duration{time.Second, time.Minute}}
+	collector.Dwell(cism.State(1), time.Second)
+	collector.Dwell(cism.State(1), 2*time.Second)
+	collector.Dwell(cism.State(1), time.Hour)
+	hist := collector.Stats().Dwell[cism.State(1)]
+
+	if len(hist.Counts) != 3 || hist.Counts[0] != 1 || hist.Counts[1] != 1 || hist.Counts[2] != 1 || hist.Count != 3 ||
+		hist.Sum != time.Hour+3*time.Second {
+		t.Fail()
+		t.Logf("%s: dwell times not bucketed: %v", name, hist)
+	}
+}
+
+func shouldEncodeExpvar(t *testing.T, name string) {
+	collector := &cism.Collector{Names: &cism.Names{
+		Events: map[cism.Event]string{cism.Event(1): "Go"},
+		States: map[cism.State]string{cism.State(1): "Here", cism.State(2): "There"},
+	}}
+	var v expvar.Var = collector
+	collector.Transition(cism.State(1), cism.Event(1), cism.State(2))
+	collector.Dwell(cism.State(1), time.Second)
+	var published struct {
+		Dwell       map[string]struct{ Count uint64 }
+		Transitions map[string]uint64
+	}
+	err := json.Unmarshal([]byte(v.String()), &published)
+
+	if err != nil || published.Transitions["Here/Go/There"] != 1 || published.Dwell["Here"].Count != 1 {
+		t.Fail()
+		t.Logf("%s: statistics not published: %v", name, err)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "sync"
+
+/*
+DefaultBuffer is the channel buffer size of a subscription that does not set a
+buffer size.
+*/
+const DefaultBuffer = 16
+
+/*
+TransitionEventKind represents what happened to a machine in a transition event.
+*/
+type TransitionEventKind int
+
+const (
+	// TransitionAccepted is published when a transition is taken
+	TransitionAccepted TransitionEventKind = iota
+	// TransitionRejected is published when a transition's guards block the state change
+	TransitionRejected
+	// EventUnhandled is published when an event has no transition in the current state
+	EventUnhandled
+	// MachineStarted is published when a machine is started
+	MachineStarted
+	// MachineStopped is published when a machine is stopped
+	MachineStopped
+	// MachineReset is published when a machine is reset
+	MachineReset
+	// MachinePaused is published when a machine is paused
+	MachinePaused
+	// MachineResumed is published when a machine is resumed
+	MachineResumed
+	// TransitionUndone is published when a transition is undone
+	TransitionUndone
+	// TransitionRedone is published when an undone transition is taken again
+	TransitionRedone
+	// TransitionRolledBack is published when a stuck choice returns the machine to the state it last rested in
+	TransitionRolledBack
+)
+
+/*
+TransitionEvent represents something that happened to a machine, published to
+its listeners and subscribers.
+*/
+type TransitionEvent struct {
+	Kind  TransitionEventKind // what happened to the machine
+	From  State               // state the machine was in
+	To    State               // state the machine went to, or would have gone to if rejected, or From if a rejected transition has branches
+	Event Event               // event that caused it, or NoEvent for start, stop, and reset
+}
+
+/*
+DeliveryPolicy determines how a subscription handles a subscriber that is slow
+to receive transition events.
+*/
+type DeliveryPolicy int
+
+const (
+	// DeliverDrop drops new transition events while the subscription's buffer is full
+	DeliverDrop DeliveryPolicy = iota
+	// DeliverBlock blocks the machine until the subscriber receives or cancels
+	DeliverBlock
+	// DeliverLatest keeps only the latest transition event the subscriber has not received
+	DeliverLatest
+)
+
+/*
+Filter selects the transition events a subscription receives and how they are
+delivered. An empty selector matches every transition event, and a transition
+event must match every selector.
+*/
+type Filter struct {
+	Buffer int                   // channel buffer size, defaults to DefaultBuffer and is 1 for DeliverLatest
+	Events []Event               // events to select, or nil for any event
+	From   []State               // from-states to select, or nil for any from-state
+	Kinds  []TransitionEventKind // kinds to select, or nil for any kind
+	Policy DeliveryPolicy        // policy for a slow subscriber, defaults to DeliverDrop
+	To     []State               // to-states to select, or nil for any to-state
+}
+
+func (f *Filter) matches(ev TransitionEvent) bool {
+	return matchesEvent(f.Events, ev.Event) && matchesState(f.From, ev.From) && matchesState(f.To, ev.To) &&
+		matchesKind(f.Kinds, ev.Kind)
+}
+
+func matchesEvent(events []Event, e Event) bool {
+	for _, event := range events {
+		if event == e {
+			return true
+		}
+	}
+
+	return len(events) == 0
+}
+
+func matchesState(states []State, s State) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+
+	return len(states) == 0
+}
+
+func matchesKind(kinds []TransitionEventKind, k TransitionEventKind) bool {
+	for _, kind := range kinds {
+		if kind == k {
+			return true
+		}
+	}
+
+	return len(kinds) == 0
+}
+
+type listener struct {
+	fn func(ev TransitionEvent)
+}
+
+type subscriber struct {
+	ch     chan TransitionEvent
+	closed bool
+	done   chan struct{}
+	filter Filter
+	mu     sync.RWMutex
+	once   sync.Once
+}
+
+func (sub *subscriber) deliver(ev TransitionEvent) {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+
+	if sub.closed {
+		return
+	}
+
+	switch sub.filter.Policy {
+	case DeliverBlock:
+		select {
+		case sub.ch <- ev:
+		case <-sub.done:
+		}
+	case DeliverLatest:
+		for {
+			select {
+			case sub.ch <- ev:
+				return
+			default:
+			}
+
+			select {
+			case <-sub.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+type observers struct {
+	listeners []*listener
+	subs      []*subscriber
+}
+
+/*
+AddListener adds a listener that is called synchronously with every transition
+event of the machine, in the order listeners were added. It returns a function
+that removes the listener. Listeners are called before subscribers receive the
+transition event.
+*/
+func (m *Machine) AddListener(l func(ev TransitionEvent)) func() {
+	added := &listener{l}
+
+	m.updateObservers(func(obs *observers) {
+		obs.listeners = append(obs.listeners, added)
+	})
+
+	return func() {
+		m.updateObservers(func(obs *observers) {
+			for i, existing := range obs.listeners {
+				if existing == added {
+					obs.listeners = append(obs.listeners[:i:i], obs.listeners[i+1:]...)
+
+					break
+				}
+			}
+		})
+	}
+}
+
+/*
+Subscribe returns a channel that receives the transition events of the machine
+selected by the given filter, and a function that cancels the subscription. The
+filter's delivery policy decides what happens when the subscriber is slow to
+receive. Canceling closes the channel, and can be called more than once.
+*/
+func (m *Machine) Subscribe(filter Filter) (<-chan TransitionEvent, func()) {
+	buffer := filter.Buffer
+
+	if filter.Policy == DeliverLatest {
+		buffer = 1
+	} else if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	sub := &subscriber{ch: make(chan TransitionEvent, buffer), done: make(chan struct{}), filter: filter}
+
+	m.updateObservers(func(obs *observers) {
+		obs.subs = append(obs.subs, sub)
+	})
+
+	return sub.ch, func() {
+		sub.once.Do(func() {
+			close(sub.done)
+
+			m.updateObservers(func(obs *observers) {
+				for i, existing := range obs.subs {
+					if existing == sub {
+						obs.subs = append(obs.subs[:i:i], obs.subs[i+1:]...)
+
+						break
+					}
+				}
+			})
+
+			sub.mu.Lock()
+			sub.closed = true
+			close(sub.ch)
+			sub.mu.Unlock()
+		})
+	}
+}
+
+func (m *Machine) updateObservers(update func(obs *observers)) {
+	m.obsmu.Lock()
+	defer m.obsmu.Unlock()
+
+	updated := &observers{}
+
+	if obs, ok := m.obs.Load().(*observers); ok {
+		*updated = *obs
+	}
+
+	update(updated)
+	m.obs.Store(updated)
+}
+
+func (m *Machine) emit(kind TransitionEventKind, from State, to State, e Event) {
+	obs, ok := m.obs.Load().(*observers)
+
+	if !ok {
+		return
+	}
+
+	ev := TransitionEvent{kind, from, to, e}
+
+	for _, l := range obs.listeners {
+		l.fn(ev)
+	}
+
+	for _, sub := range obs.subs {
+		if sub.filter.matches(ev) {
+			sub.deliver(ev)
+		}
+	}
+}
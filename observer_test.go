@@ -0,0 +1,229 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_AddListener(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should receive every transition event":  shouldReceiveAllListener,
+		"should not receive after removal":       shouldNotReceiveRemovedListener,
+		"should reject branches to source state": shouldRejectBranchesListener,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_Subscribe(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should receive filtered transition events": shouldReceiveFilteredSubscribe,
+		"should drop when buffer full":              shouldDropSubscribe,
+		"should keep latest when latest only":       shouldKeepLatestSubscribe,
+		"should block until received":               shouldBlockSubscribe,
+		"should close channel when canceled":        shouldCloseCanceledSubscribe,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func observedMachine() *cism.Machine {
+	return &cism.Machine{States: cism.StateTransitionTable{
+		cism.State(1): {
+			cism.Event(1): &cism.Transition{To: cism.State(2)},
+			cism.Event(2): &cism.Transition{
+				Guard: func(s cism.State, e cism.Event) bool {
+					return false
+				},
+				To: cism.State(2),
+			},
+		},
+		cism.State(2): {cism.Event(1): &cism.Transition{To: cism.State(1)}},
+	}, Unhandled: cism.UnhandledIgnore}
+}
+
+func shouldReceiveAllListener(t *testing.T, name string) {
+	machine := observedMachine()
+	var kinds []cism.TransitionEventKind
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		kinds = append(kinds, ev.Kind)
+	})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	sendErr2 := machine.Send(cism.Event(1))
+	sendErr3 := machine.Send(cism.Event(3))
+	machine.Stop()
+	resetErr := machine.Reset()
+	expected := []cism.TransitionEventKind{cism.MachineStarted, cism.TransitionRejected, cism.TransitionAccepted,
+		cism.EventUnhandled, cism.MachineStopped, cism.MachineReset}
+
+	if len(kinds) != len(expected) || startErr != nil || sendErr != nil || sendErr2 != nil || sendErr3 != nil ||
+		resetErr != nil {
+		t.Fail()
+		t.Logf("%s: transition events not received", name)
+
+		return
+	}
+
+	for i, kind := range expected {
+		if kinds[i] != kind {
+			t.Fail()
+			t.Logf("%s: transition events out of order", name)
+		}
+	}
+}
+
+func shouldRejectBranchesListener(t *testing.T, name string) {
+	var to cism.State
+	machine := &cism.Machine{States: cism.StateTransitionTable{
+		cism.State(5): {cism.Event(1): &cism.Transition{Branches: []*cism.Transition{{
+			Guard: func(s cism.State, e cism.Event) bool {
+				return false
+			},
+			To: cism.State(6),
+		}}, OnFailV2: func(tc *cism.TransitionContext) error {
+			to = tc.To
+
+			return nil
+		}}},
+		cism.State(6): {},
+	}}
+	var events []cism.TransitionEvent
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		events = append(events, ev)
+	})
+	startErr := machine.Start(cism.State(5))
+	sendErr := machine.Send(cism.Event(1))
+	rejected := cism.TransitionEvent{Kind: cism.TransitionRejected, From: cism.State(5), To: cism.State(5),
+		Event: cism.Event(1)}
+
+	if len(events) != 2 || events[1] != rejected || to != cism.State(5) || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: rejected branches not sent to source state: %v", name, events)
+	}
+}
+
+func shouldNotReceiveRemovedListener(t *testing.T, name string) {
+	machine := observedMachine()
+	received := 0
+	remove := machine.AddListener(func(ev cism.TransitionEvent) {
+		received++
+	})
+	startErr := machine.Start(cism.State(1))
+	remove()
+	sendErr := machine.Send(cism.Event(1))
+
+	if received != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: removed listener received", name)
+	}
+}
+
+func shouldReceiveFilteredSubscribe(t *testing.T, name string) {
+	machine := observedMachine()
+	events, cancel := machine.Subscribe(cism.Filter{
+		From:  []cism.State{cism.State(1)},
+		Kinds: []cism.TransitionEventKind{cism.TransitionAccepted},
+	})
+	defer cancel()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+
+	if len(events) != 1 || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: transition events not filtered", name)
+
+		return
+	}
+
+	if ev := <-events; ev.From != cism.State(1) || ev.To != cism.State(2) || ev.Event != cism.Event(1) {
+		t.Fail()
+		t.Logf("%s: transition event incorrect", name)
+	}
+}
+
+func shouldDropSubscribe(t *testing.T, name string) {
+	machine := observedMachine()
+	events, cancel := machine.Subscribe(cism.Filter{Buffer: 1, Kinds: []cism.TransitionEventKind{cism.TransitionAccepted}})
+	defer cancel()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+
+	if ev := <-events; ev.From != cism.State(1) || len(events) != 0 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: transition event not dropped", name)
+	}
+}
+
+func shouldKeepLatestSubscribe(t *testing.T, name string) {
+	machine := observedMachine()
+	events, cancel := machine.Subscribe(cism.Filter{
+		Kinds:  []cism.TransitionEventKind{cism.TransitionAccepted},
+		Policy: cism.DeliverLatest,
+	})
+	defer cancel()
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(1))
+
+	if ev := <-events; ev.From != cism.State(2) || len(events) != 0 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: latest transition event not kept", name)
+	}
+}
+
+func shouldBlockSubscribe(t *testing.T, name string) {
+	machine := observedMachine()
+	events, cancel := machine.Subscribe(cism.Filter{
+		Buffer: 1,
+		Kinds:  []cism.TransitionEventKind{cism.TransitionAccepted},
+		Policy: cism.DeliverBlock,
+	})
+	defer cancel()
+	startErr := machine.Start(cism.State(1))
+	done := make(chan error)
+
+	go func() {
+		err := machine.Send(cism.Event(1))
+
+		if err == nil {
+			err = machine.Send(cism.Event(1))
+		}
+
+		done <- err
+	}()
+
+	first := <-events
+	second := <-events
+	sendErr := <-done
+
+	if first.From != cism.State(1) || second.From != cism.State(2) || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: transition events not delivered", name)
+	}
+}
+
+func shouldCloseCanceledSubscribe(t *testing.T, name string) {
+	machine := observedMachine()
+	events, cancel := machine.Subscribe(cism.Filter{})
+	cancel()
+	cancel()
+	startErr := machine.Start(cism.State(1))
+
+	if _, ok := <-events; ok || startErr != nil {
+		t.Fail()
+		t.Logf("%s: channel not closed", name)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/*
+PausePolicy determines how a paused machine handles the events sent to it.
+*/
+type PausePolicy int
+
+const (
+	// PauseReject makes Send return ErrMachinePaused while the machine is paused
+	PauseReject PausePolicy = iota
+	// PauseQueue queues the event to be sent when the machine is resumed
+	PauseQueue
+)
+
+/*
+Pause holds the machine in its current state until it is resumed. It will return
+an error if the machine has not been started. It will return an error if the
+machine has been stopped. Pausing a paused machine does nothing.
+
+While the machine is paused, its state, extended state, history log, and
+deferred events are left untouched, and the time it is paused for is not counted
+in the dwell time of its current state. Events sent to it are rejected or
+queued, depending on the machine's pause policy. An event that is being sent
+when the machine is paused, such as from a hook, still finishes its state
+change, but the deferred events are not sent again until the machine is
+resumed.
+*/
+func (m *Machine) Pause() error {
+	if !m.started {
+		return m.notStarted()
+	}
+
+	if m.done {
+		return m.stopped()
+	}
+
+	if m.paused {
+		return nil
+	}
+
+	m.paused = true
+
+	if m.Metrics != nil {
+		m.pausedat = time.Now()
+	}
+
+	m.publish()
+	m.logLifecycle("machine paused", m.curr, NoEvent)
+	m.emit(MachinePaused, m.curr, m.curr, NoEvent)
+
+	return nil
+}
+
+/*
+Resume continues a paused machine from exactly where it left off. It will
+return an error if the machine has not been started. It will return an error if
+the machine has been stopped. Resuming a machine that is not paused does
+nothing.
+
+Deferred events that were held back by the pause are sent again first. The
+events queued while the machine was paused are then sent in order, with
+their payloads, exactly like Send. It will return the errors of the queued
+events joined together. If the machine is paused again or stopped by a queued
+event, the events after it stay queued or are dropped into the dead letter log.
+*/
+func (m *Machine) Resume() error {
+	if !m.started {
+		return m.notStarted()
+	}
+
+	if m.done {
+		return m.stopped()
+	}
+
+	if !m.paused {
+		return nil
+	}
+
+	m.paused = false
+
+	if m.Metrics != nil {
+		m.entered = m.entered.Add(time.Since(m.pausedat))
+	}
+
+	m.publish()
+	m.logLifecycle("machine resumed", m.curr, NoEvent)
+	m.emit(MachineResumed, m.curr, m.curr, NoEvent)
+
+	if m.resend {
+		m.resend = false
+
+		m.redispatch()
+	}
+
+	var errs []error
+
+	for len(m.queued) > 0 && !m.paused && !m.done {
+		p := m.queued[0]
+		m.queued = m.queued[1:]
+
+		if err := m.send(context.Background(), p.event, p.payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Queued returns a copy of the events waiting to be sent when the machine is
+resumed.
+*/
+func (m *Machine) Queued() []Event {
+	cpyqueued := make([]Event, len(m.queued))
+
+	for i, p := range m.queued {
+		cpyqueued[i] = p.event
+	}
+
+	return cpyqueued
+}
+
+func (m *Machine) hold(e Event, payload interface{}) error {
+	if m.WhilePaused == PauseQueue {
+		m.queued = append(m.queued, pending{e, payload})
+
+		return nil
+	}
+
+	return &ErrMachinePaused{m.curr, e, "machine is paused and not accepting transitions"}
+}
+
+func (m *Machine) drop() {
+	for _, p := range m.queued {
+		m.dead = append(m.dead, DeadLetter{m.curr, p.event})
+	}
+
+	m.queued = nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+	"time"
+)
+
+func TestMachine_Pause(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when machine not started":     shouldErrPauseNotStarted,
+		"should reject events while paused":       shouldRejectPaused,
+		"should queue events while paused":        shouldQueuePaused,
+		"should drop queued events on stop":       shouldDropQueuedOnStop,
+		"should not count paused time as dwell":   shouldNotCountPausedDwell,
+		"should hold deferred events when paused": shouldHoldDeferredPaused,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldHoldDeferredPaused(t *testing.T, name string) {
+	machine := &cism.Machine{
+		States: cism.StateTransitionTable{
+			cism.State(1): {cism.Event(1): &cism.Transition{To: cism.State(2)}},
+			cism.State(2): {cism.Event(2): &cism.Transition{To: cism.State(3)}},
+			cism.State(3): {},
+		},
+		Unhandled: cism.UnhandledDefer,
+	}
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccess = func(s cism.State, e cism.Event) {
+		_ = machine.Pause()
+	}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	sendErr2 := machine.Send(cism.Event(1))
+	paused := machine.Current()
+	deferred := machine.Deferred()
+	resumeErr := machine.Resume()
+
+	if paused != cism.State(2) || len(deferred) != 1 || deferred[0] != cism.Event(2) ||
+		machine.Current() != cism.State(3) || len(machine.Deferred()) != 0 || startErr != nil || sendErr != nil ||
+		sendErr2 != nil || resumeErr != nil {
+		t.Fail()
+		t.Logf("%s: deferred events not held: %v %v", name, paused, deferred)
+	}
+}
+
+func TestMachine_Resume(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when machine stopped":     shouldErrResumeStopped,
+		"should drain queued events in order": shouldDrainQueued,
+		"should join queued event errors":     shouldJoinQueuedErrors,
+		"should keep queue when paused again": shouldKeepQueuePausedAgain,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+type dwellSink struct {
+	cism.MetricsSink
+	dwell []time.Duration
+}
+
+func (s *dwellSink) Dwell(st cism.State, d time.Duration) {
+	s.dwell = append(s.dwell, d)
+}
+
+func (s *dwellSink) Transition(from cism.State, e cism.Event, to cism.State) {}
+
+func shouldErrPauseNotStarted(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	var machineErr *cism.ErrMachineNotStarted
+	err := machine.Pause()
+
+	if !errors.As(err, &machineErr) || machine.Status() != cism.NotStarted {
+		t.Fail()
+		t.Logf("%s: expected not started error, got %v", name, err)
+	}
+}
+
+func shouldRejectPaused(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	var kinds []cism.TransitionEventKind
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		kinds = append(kinds, ev.Kind)
+	})
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	pauseErr2 := machine.Pause()
+	status := machine.Status()
+	var machineErr *cism.ErrMachinePaused
+	err := machine.Send(cism.Event(1))
+	resumeErr := machine.Resume()
+	sendErr := machine.Send(cism.Event(1))
+
+	if !errors.As(err, &machineErr) || machineErr.State != cism.State(1) || machineErr.Event != cism.Event(1) ||
+		status != cism.Paused || machine.Status() != cism.Running || machine.Current() != cism.State(2) ||
+		len(kinds) != 4 || kinds[1] != cism.MachinePaused || kinds[2] != cism.MachineResumed ||
+		startErr != nil || pauseErr != nil || pauseErr2 != nil || resumeErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: events not rejected while paused: %v", name, err)
+	}
+}
+
+func shouldQueuePaused(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable(), WhilePaused: cism.PauseQueue}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	queued := machine.Queued()
+
+	if len(queued) != 2 || queued[0] != cism.Event(1) || queued[1] != cism.Event(2) ||
+		machine.Current() != cism.State(1) || len(machine.History()) != 0 || startErr != nil ||
+		pauseErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: events not queued while paused: %v", name, queued)
+	}
+}
+
+func shouldDropQueuedOnStop(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable(), WhilePaused: cism.PauseQueue}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.Send(cism.Event(1))
+	machine.Stop()
+	dead := machine.DeadLetters()
+
+	if len(dead) != 1 || dead[0].Event != cism.Event(1) || len(machine.Queued()) != 0 ||
+		machine.Status() != cism.Stopped || startErr != nil || pauseErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: queued events not dropped: %v", name, dead)
+	}
+}
+
+func shouldNotCountPausedDwell(t *testing.T, name string) {
+	sink := &dwellSink{}
+	machine := &cism.Machine{Metrics: sink, States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	time.Sleep(50 * time.Millisecond)
+	resumeErr := machine.Resume()
+	sendErr := machine.Send(cism.Event(1))
+
+	if len(sink.dwell) != 1 || sink.dwell[0] >= 50*time.Millisecond || startErr != nil || pauseErr != nil ||
+		resumeErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: paused time counted as dwell: %v", name, sink.dwell)
+	}
+}
+
+func shouldErrResumeStopped(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	machine.Stop()
+	var machineErr *cism.ErrMachineStopped
+	err := machine.Resume()
+
+	if !errors.As(err, &machineErr) || startErr != nil || pauseErr != nil {
+		t.Fail()
+		t.Logf("%s: expected stopped error, got %v", name, err)
+	}
+}
+
+func shouldDrainQueued(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable(), WhilePaused: cism.PauseQueue}
+	var payloads []interface{}
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccessV2 = func(ctx *cism.TransitionContext) error {
+		payloads = append(payloads, ctx.Payload)
+
+		return nil
+	}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.SendPayload(cism.Event(1), "first")
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.SendPayload(cism.Event(1), "second")
+	resumeErr := machine.Resume()
+	hist := machine.History()
+
+	if len(hist) != 3 || hist[0].Event != cism.Event(1) || hist[1].Event != cism.Event(2) ||
+		machine.Current() != cism.State(2) || len(payloads) != 2 || payloads[0] != "first" ||
+		payloads[1] != "second" || len(machine.Queued()) != 0 || startErr != nil || pauseErr != nil ||
+		sendErr != nil || sendErr2 != nil || sendErr3 != nil || resumeErr != nil {
+		t.Fail()
+		t.Logf("%s: queued events not drained: %v", name, hist)
+	}
+}
+
+func shouldJoinQueuedErrors(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable(), WhilePaused: cism.PauseQueue}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.Send(cism.Event(3))
+	sendErr2 := machine.Send(cism.Event(1))
+	var machineErr *cism.ErrMissingTransition
+	err := machine.Resume()
+
+	if !errors.As(err, &machineErr) || machineErr.Event != cism.Event(3) || machine.Current() != cism.State(2) ||
+		startErr != nil || pauseErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: expected missing transition error, got %v", name, err)
+	}
+}
+
+func shouldKeepQueuePausedAgain(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable(), WhilePaused: cism.PauseQueue}
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccess = func(s cism.State, e cism.Event) {
+		_ = machine.Pause()
+	}
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	resumeErr := machine.Resume()
+	queued := machine.Queued()
+
+	if len(queued) != 1 || queued[0] != cism.Event(2) || machine.Status() != cism.Paused ||
+		machine.Current() != cism.State(2) || startErr != nil || pauseErr != nil || sendErr != nil ||
+		sendErr2 != nil || resumeErr != nil {
+		t.Fail()
+		t.Logf("%s: queue not kept when paused again: %v", name, queued)
+	}
+}
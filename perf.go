@@ -0,0 +1,35 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+func (m *Machine) missing(s State, e Event, msg string) error {
+	if !m.ReuseErrors {
+		return &ErrMissingTransition{s, e, msg}
+	}
+
+	m.errmissing = ErrMissingTransition{s, e, msg}
+
+	return &m.errmissing
+}
+
+func (m *Machine) notStarted() error {
+	if !m.ReuseErrors {
+		return &ErrMachineNotStarted{"machine has not started"}
+	}
+
+	m.errnotstart = ErrMachineNotStarted{"machine has not started"}
+
+	return &m.errnotstart
+}
+
+func (m *Machine) stopped() error {
+	if !m.ReuseErrors {
+		return &ErrMachineStopped{m.endevt, "machine is done and not accepting transitions"}
+	}
+
+	m.errstopped = ErrMachineStopped{m.endevt, "machine is done and not accepting transitions"}
+
+	return &m.errstopped
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_HistoryLimit(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should keep most recent records":         shouldKeepRecentHistory,
+		"should keep final event when limited":    shouldKeepFinalEventLimited,
+		"should keep rollback in limited history": shouldRevertChoiceLimited,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_ReuseErrors(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should reuse error values": shouldReuseErrors,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_ZeroAlloc(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should not allocate per accepted send":  shouldNotAllocAccepted,
+		"should not allocate per unhandled send": shouldNotAllocUnhandled,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldKeepRecentHistory(t *testing.T, name string) {
+	machine := &cism.Machine{HistoryLimit: 3, States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+
+	for i := 0; i < 5; i++ {
+		if err := machine.Send(cism.Event(1 + i%2)); err != nil {
+			t.Fail()
+			t.Logf("%s: send errored: %v", name, err)
+		}
+	}
+
+	hist := machine.History()
+
+	if len(hist) != 3 || hist[0].Event != cism.Event(1) || hist[1].Event != cism.Event(2) ||
+		hist[2].Event != cism.Event(1) || hist[2].To != cism.State(2) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: history not limited: %v", name, hist)
+	}
+}
+
+func shouldKeepFinalEventLimited(t *testing.T, name string) {
+	stt := benchTable()
+	stt[cism.State(2)][cism.Event(3)] = &cism.Transition{IsFinal: true, To: cism.State(1)}
+	machine := &cism.Machine{HistoryLimit: 2, States: stt}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(1))
+	sendErr4 := machine.Send(cism.Event(3))
+	var machineErr *cism.ErrMachineStopped
+	err := machine.Send(cism.Event(1))
+
+	if !errors.As(err, &machineErr) || machineErr.FinalEvent == nil || *machineErr.FinalEvent != cism.Event(3) ||
+		startErr != nil || sendErr != nil || sendErr2 != nil || sendErr3 != nil || sendErr4 != nil {
+		t.Fail()
+		t.Logf("%s: final event not kept", name)
+	}
+}
+
+func shouldRevertChoiceLimited(t *testing.T, name string) {
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return false
+	}, nil)
+	machine.HistoryLimit = 2
+	machine.States[cism.State(1)][cism.Event(2)] = &cism.Transition{To: cism.State(1)}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(2))
+	var machineErr *cism.ErrChoiceStuck
+	err := machine.Send(cism.Event(1))
+	hist := machine.History()
+
+	if !errors.As(err, &machineErr) || machine.Current() != cism.State(1) || len(hist) != 2 ||
+		hist[0].Event != cism.Event(1) || hist[1].Kind != cism.RollbackTransition || startErr != nil || sendErr != nil ||
+		sendErr2 != nil || sendErr3 != nil {
+		t.Fail()
+		t.Logf("%s: choice not reverted: %v", name, hist)
+	}
+}
+
+func shouldReuseErrors(t *testing.T, name string) {
+	machine := &cism.Machine{ReuseErrors: true, States: benchTable()}
+	notStartedErr := machine.Send(cism.Event(1))
+	notStartedErr2 := machine.Send(cism.Event(1))
+	startErr := machine.Start(cism.State(1))
+	missingErr := machine.Send(cism.Event(3))
+	sendErr := machine.Send(cism.Event(1))
+	missingErr2 := machine.Send(cism.Event(3))
+	machine.Stop()
+	stoppedErr := machine.Send(cism.Event(1))
+	var missing *cism.ErrMissingTransition
+	var stopped *cism.ErrMachineStopped
+
+	if notStartedErr == nil || notStartedErr != notStartedErr2 || missingErr != missingErr2 ||
+		!errors.As(missingErr2, &missing) || missing.State != cism.State(2) || missing.Event != cism.Event(3) ||
+		!errors.As(stoppedErr, &stopped) || stopped.FinalEvent == nil || *stopped.FinalEvent != cism.Event(1) ||
+		startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: errors not reused", name)
+	}
+}
+
+func shouldNotAllocAccepted(t *testing.T, name string) {
+	for _, machine := range []*cism.Machine{
+		{HistoryLimit: 16, States: benchTable()},
+		{Compiled: benchTable().Compile(), HistoryLimit: 16},
+	} {
+		i := 0
+		startErr := machine.Start(cism.State(1))
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = machine.Send(cism.Event(1 + i%2))
+			i++
+		})
+
+		if allocs != 0 || startErr != nil || len(machine.History()) != 16 {
+			t.Fail()
+			t.Logf("%s: accepted send allocated %v times", name, allocs)
+		}
+	}
+}
+
+func shouldNotAllocUnhandled(t *testing.T, name string) {
+	machine := &cism.Machine{Compiled: benchTable().Compile(), HistoryLimit: 16, ReuseErrors: true}
+	startErr := machine.Start(cism.State(1))
+	allocs := testing.AllocsPerRun(1000, func() {
+		_ = machine.Send(cism.Event(3))
+	})
+
+	if allocs != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: unhandled send allocated %v times", name, allocs)
+	}
+}
+
+func BenchmarkMachine_SendZeroAlloc(b *testing.B) {
+	benchSend(b, &cism.Machine{HistoryLimit: 64, States: benchTable()})
+}
+
+func BenchmarkMachine_SendCompiledZeroAlloc(b *testing.B) {
+	benchSend(b, &cism.Machine{Compiled: benchTable().Compile(), HistoryLimit: 64})
+}
+
+func BenchmarkMachine_SendUnhandled(b *testing.B) {
+	machine := &cism.Machine{Compiled: benchTable().Compile(), HistoryLimit: 64, ReuseErrors: true}
+
+	if err := machine.Start(cism.State(1)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = machine.Send(cism.Event(3))
+	}
+}
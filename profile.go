@@ -0,0 +1,51 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+)
+
+/*
+ProfileStateLabel and ProfileEventLabel are the pprof label keys set to the
+names of the state and event involved while a profiled machine runs a hook.
+They are added to the labels of the context the event was sent with, which
+replace the goroutine's labels until the hook returns. A profiled machine must
+be driven with SendContext and the caller's labeled context to keep the
+caller's labels, since Send and the other methods without a context leave the
+goroutine with no labels at all.
+*/
+const (
+	ProfileStateLabel = "cism.state"
+	ProfileEventLabel = "cism.event"
+)
+
+func (m *Machine) region(ctx context.Context, e Event) *trace.Region {
+	return trace.StartRegion(ctx, m.Names.Event(e))
+}
+
+func (m *Machine) hookStart(ctx context.Context, s State, e Event) time.Time {
+	if m.Profiling {
+		labels := pprof.Labels(ProfileStateLabel, m.Names.State(s), ProfileEventLabel, m.Names.Event(e))
+
+		pprof.SetGoroutineLabels(pprof.WithLabels(ctx, labels))
+	}
+
+	return m.clock()
+}
+
+func (m *Machine) hookEnd(ctx context.Context, hook string, s State, e Event, start time.Time) {
+	m.unlabel(ctx)
+	m.logHook(ctx, hook, s, e, start)
+}
+
+func (m *Machine) unlabel(ctx context.Context) {
+	if m.Profiling {
+		pprof.SetGoroutineLabels(ctx)
+	}
+}
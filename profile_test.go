@@ -0,0 +1,130 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/sebuckler/cism"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"testing"
+)
+
+func TestMachine_Profiling(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should label hooks for pprof":       shouldLabelHooks,
+		"should not label without profiling": shouldNotLabelHooks,
+		"should trace regions for events":    shouldTraceRegions,
+		"should keep caller labels":          shouldKeepCallerLabels,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func goroutineLabels() string {
+	var buf bytes.Buffer
+
+	_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+
+	return buf.String()
+}
+
+func profiledMachine(labels *[]string) *cism.Machine {
+	return &cism.Machine{
+		Names: &cism.Names{
+			Events: map[cism.Event]string{cism.Event(1): "ProfiledEvent"},
+			States: map[cism.State]string{cism.State(1): "ProfiledState"},
+		},
+		Profiling: true,
+		States: cism.StateTransitionTable{
+			cism.State(1): {
+				cism.Event(1): &cism.Transition{
+					Guard: func(s cism.State, e cism.Event) bool {
+						*labels = append(*labels, goroutineLabels())
+
+						return true
+					},
+					OnSuccess: func(s cism.State, e cism.Event) {
+						*labels = append(*labels, goroutineLabels())
+					},
+					To: cism.State(2),
+				},
+			},
+			cism.State(2): {},
+		},
+	}
+}
+
+func shouldLabelHooks(t *testing.T, name string) {
+	var labels []string
+	machine := profiledMachine(&labels)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	label := `"cism.event":"ProfiledEvent", "cism.state":"ProfiledState"`
+
+	if len(labels) != 2 || !strings.Contains(labels[0], label) || !strings.Contains(labels[1], label) ||
+		strings.Contains(goroutineLabels(), label) || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: hooks not labeled", name)
+	}
+}
+
+func shouldNotLabelHooks(t *testing.T, name string) {
+	var labels []string
+	machine := profiledMachine(&labels)
+	machine.Profiling = false
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if len(labels) != 2 || strings.Contains(labels[0], "cism.state") || strings.Contains(labels[1], "cism.state") ||
+		startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: hooks labeled without profiling", name)
+	}
+}
+
+func shouldTraceRegions(t *testing.T, name string) {
+	var labels []string
+	var buf bytes.Buffer
+	machine := profiledMachine(&labels)
+	startErr := machine.Start(cism.State(1))
+	traceErr := trace.Start(&buf)
+	sendErr := machine.Send(cism.Event(1))
+
+	if traceErr == nil {
+		trace.Stop()
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte("ProfiledEvent")) || startErr != nil || traceErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: region not traced", name)
+	}
+}
+
+func shouldKeepCallerLabels(t *testing.T, name string) {
+	var labels []string
+	var after string
+	var sendErr error
+	machine := profiledMachine(&labels)
+	startErr := machine.Start(cism.State(1))
+
+	pprof.Do(context.Background(), pprof.Labels("request", "42"), func(ctx context.Context) {
+		sendErr = machine.SendContext(ctx, cism.Event(1))
+		after = goroutineLabels()
+	})
+
+	caller := `"request":"42"`
+
+	if len(labels) != 2 || !strings.Contains(labels[0], caller) || !strings.Contains(labels[0], "cism.state") ||
+		!strings.Contains(after, caller) || strings.Contains(after, "cism.state") || startErr != nil ||
+		sendErr != nil {
+		t.Fail()
+		t.Logf("%s: caller labels not kept", name)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+/*
+Position represents a consistent reading of a machine's current state, status,
+and transition sequence number, published together by the machine.
+*/
+type Position struct {
+	Seq    uint64 // count of records pushed into the history log since the machine was created, which only increases
+	State  State  // current state of the machine
+	Status Status // current status of the machine
+}
+
+type publication struct {
+	curr    atomic.Int64
+	seq     atomic.Uint64
+	state   atomic.Int64
+	status  atomic.Int32
+	version atomic.Uint64
+}
+
+/*
+Position returns the machine's current state, status, and transition sequence
+number without locking. It is safe to call from other goroutines while events
+are being sent, and never blocks the machine.
+
+The machine publishes a new position once a sent event and the eventless
+transitions that follow it have settled in a real state, and every time it
+starts, stops, pauses, resumes, resets, undoes, or redoes. States the machine
+only passes through, including pseudo-states, are never published.
+
+Seq counts the records pushed into the history log, so it tells a reader that
+the machine has moved on. The history log itself is not safe to read while
+events are being sent, so only the goroutine sending events can match a
+position against History.
+*/
+func (m *Machine) Position() Position {
+	for {
+		version := m.pub.version.Load()
+
+		if version&1 == 0 {
+			pos := Position{m.pub.seq.Load(), State(m.pub.state.Load()), Status(m.pub.status.Load())}
+
+			if m.pub.version.Load() == version {
+				return pos
+			}
+		}
+
+		runtime.Gosched()
+	}
+}
+
+func (m *Machine) status() Status {
+	switch {
+	case m.done && m.completed:
+		return Completed
+	case m.done:
+		return Stopped
+	case m.paused:
+		return Paused
+	case m.started:
+		return Running
+	}
+
+	return NotStarted
+}
+
+func (m *Machine) publish() {
+	m.pub.version.Add(1)
+	m.pub.curr.Store(int64(m.curr))
+	m.pub.seq.Store(m.hist.seq)
+	m.pub.state.Store(int64(m.curr))
+	m.pub.status.Store(int32(m.status()))
+	m.pub.version.Add(1)
+}
+
+func (m *Machine) track() {
+	if m.pseudo(m.curr) == RealState {
+		m.pub.curr.Store(int64(m.curr))
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"sync"
+	"testing"
+)
+
+func TestMachine_Position(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should publish lifecycle positions":      shouldPublishLifecycle,
+		"should publish transitions in order":     shouldPublishTransitions,
+		"should publish settled states only":      shouldPublishSettled,
+		"should report entered state in hooks":    shouldReportCurrentInHooks,
+		"should read consistent positions racing": shouldReadPositionsRacing,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func shouldPublishLifecycle(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	before := machine.Position()
+	startErr := machine.Start(cism.State(1))
+	started := machine.Position()
+	sendErr := machine.Send(cism.Event(1))
+	machine.Stop()
+	stopped := machine.Position()
+	resetErr := machine.Reset()
+	reset := machine.Position()
+
+	if before != (cism.Position{Seq: 0, State: cism.State(0), Status: cism.NotStarted}) ||
+		started != (cism.Position{Seq: 0, State: cism.State(1), Status: cism.Running}) ||
+		stopped != (cism.Position{Seq: 1, State: cism.State(2), Status: cism.Stopped}) ||
+		reset != (cism.Position{Seq: 1, State: cism.State(1), Status: cism.NotStarted}) ||
+		startErr != nil || sendErr != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: lifecycle not published", name)
+	}
+}
+
+func shouldPublishTransitions(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	var seen []cism.Position
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccess = func(s cism.State, e cism.Event) {
+		seen = append(seen, machine.Position())
+	}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(4))
+	pos := machine.Position()
+
+	if len(seen) != 1 || seen[0] != (cism.Position{Seq: 0, State: cism.State(1), Status: cism.Running}) ||
+		pos.Seq != 2 || pos.State != cism.State(2) || machine.Current() != cism.State(2) ||
+		len(machine.History()) != int(pos.Seq) || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: transitions not published: %v %v", name, seen, pos)
+	}
+}
+
+func shouldPublishSettled(t *testing.T, name string) {
+	var machine *cism.Machine
+	var seen []cism.State
+	machine = choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		seen = append(seen, machine.Current())
+
+		return true
+	}, nil)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	pos := machine.Position()
+
+	if len(seen) != 1 || seen[0] != cism.State(1) ||
+		pos != (cism.Position{Seq: 2, State: cism.State(3), Status: cism.Running}) || startErr != nil ||
+		sendErr != nil {
+		t.Fail()
+		t.Logf("%s: unsettled state published: %v %v", name, seen, pos)
+	}
+}
+
+func shouldReportCurrentInHooks(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	var seen []cism.State
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccess = func(s cism.State, e cism.Event) {
+		seen = append(seen, machine.Current(), machine.Snapshot().State)
+	}
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccessV2 = func(tc *cism.TransitionContext) error {
+		seen = append(seen, tc.Machine.Current(), tc.Machine.Snapshot().State)
+
+		return nil
+	}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+
+	if len(seen) != 4 || seen[0] != cism.State(2) || seen[1] != cism.State(2) || seen[2] != cism.State(2) ||
+		seen[3] != cism.State(2) || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: entered state not reported: %v", name, seen)
+	}
+}
+
+func shouldReadPositionsRacing(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			last := uint64(0)
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				pos := machine.Position()
+				want := cism.State(1)
+
+				if pos.Seq%2 == 1 {
+					want = cism.State(2)
+				}
+
+				if pos.Seq < last || pos.State != want || pos.Status != cism.Running ||
+					machine.Current() == cism.State(0) {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+
+				last = pos.Seq
+			}
+		}()
+	}
+
+	for i := 0; i < 2000; i++ {
+		_ = machine.Send(cism.Event(1 + i%2))
+	}
+
+	close(done)
+	wg.Wait()
+
+	if failed || startErr != nil || machine.Position().Seq != 2000 {
+		t.Fail()
+		t.Logf("%s: inconsistent position read", name)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "context"
+
+/*
+Can reports whether the given event has a transition the machine could take
+right now. It returns false if the machine is not running or is paused, or if
+the event is NoEvent or AnyEvent.
+
+If the machine probes guards, the guards of the transition and its branches are
+evaluated as well, and Can only returns true if the transition or one of its
+branches passes. Probing is free of side effects: no failure hooks, logging,
+metrics, tracing, or listeners are triggered, so guards themselves must be free
+of side effects too. Interceptors and junctions are not consulted.
+*/
+func (m *Machine) Can(e Event) bool {
+	if !m.started || m.done || m.paused || e == NoEvent || e == AnyEvent {
+		return false
+	}
+
+	tran := m.lookup(m.curr, e)
+
+	return tran != nil && (!m.ProbeGuards || m.probe(tran, m.curr, e))
+}
+
+/*
+AvailableEvents returns the events the machine could take a transition for right
+now, exactly like Can, sorted in ascending order. The events are those of
+GetEventsForState for the current state, so an AnyEvent transition does not
+make every event available. It will return an empty slice if the machine is not
+running or is paused.
+*/
+func (m *Machine) AvailableEvents() []Event {
+	if !m.started || m.done || m.paused {
+		return nil
+	}
+
+	var events []Event
+
+	for _, e := range m.events(m.curr) {
+		if m.Can(e) {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+func (m *Machine) events(s State) []Event {
+	if m.Compiled != nil {
+		return m.Compiled.GetEventsForState(s)
+	}
+
+	return m.States.GetEventsForState(s)
+}
+
+func (m *Machine) probe(tran *Transition, s State, e Event) bool {
+	d := delivery{ctx: context.Background()}
+
+	if !tran.unguarded() && !m.guard(tran, s, e, &d) {
+		return false
+	}
+
+	if len(tran.Branches) == 0 {
+		return true
+	}
+
+	for _, branch := range tran.Branches {
+		if branch != nil && (branch.unguarded() || m.guard(branch, s, e, &d)) {
+			return true
+		}
+	}
+
+	return false
+}
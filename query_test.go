@@ -0,0 +1,188 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_Can(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should be false when machine not running": shouldNotCanNotRunning,
+		"should be false for reserved events":      shouldNotCanReserved,
+		"should ignore guards when not probing":    shouldCanIgnoreGuards,
+		"should probe guards without side effects": shouldCanProbeGuards,
+		"should pass when a branch passes":         shouldCanProbeBranches,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_AvailableEvents(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should return sorted events":            shouldAvailableSorted,
+		"should leave out events failing guards": shouldAvailableProbed,
+		"should be empty when machine paused":    shouldAvailablePaused,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func queryMachine(calls *[]string) *cism.Machine {
+	hook := recorder(calls)
+	guard := hook("guard")
+	block := func(s cism.State, e cism.Event) bool {
+		guard(s, e)
+
+		return false
+	}
+
+	return &cism.Machine{
+		States: cism.StateTransitionTable{
+			cism.State(1): {
+				cism.Event(9): {To: cism.State(2)},
+				cism.Event(3): {Guard: block, OnFail: hook("fail"), To: cism.State(2)},
+				cism.Event(7): {Branches: []*cism.Transition{{Guard: block}, {To: cism.State(2)}}},
+				cism.Event(8): {Branches: []*cism.Transition{{Guard: block, To: cism.State(2)}}},
+				cism.NoEvent:  {Guard: func(s cism.State, e cism.Event) bool { return false }, To: cism.State(2)},
+			},
+			cism.State(2): {},
+			cism.AnyState: {
+				cism.Event(5): {Internal: true},
+				cism.AnyEvent: {Internal: true},
+			},
+		},
+	}
+}
+
+func shouldNotCanNotRunning(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	notStarted := machine.Can(cism.Event(9))
+	startErr := machine.Start(cism.State(1))
+	running := machine.Can(cism.Event(9))
+	machine.Stop()
+
+	if notStarted || !running || machine.Can(cism.Event(9)) || len(machine.AvailableEvents()) != 0 ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: expected only running machine to take event", name)
+	}
+}
+
+func shouldNotCanReserved(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+
+	if machine.Can(cism.NoEvent) || machine.Can(cism.AnyEvent) || !machine.Can(cism.Event(4)) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: reserved events reported", name)
+	}
+}
+
+func shouldCanIgnoreGuards(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+
+	if !machine.Can(cism.Event(3)) || len(calls) != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: guards evaluated: %v", name, calls)
+	}
+}
+
+func shouldCanProbeGuards(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	machine.ProbeGuards = true
+	collector := &cism.Collector{}
+	machine.Metrics = collector
+	var kinds []cism.TransitionEventKind
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		kinds = append(kinds, ev.Kind)
+	})
+	startErr := machine.Start(cism.State(1))
+	kinds = nil
+	before := len(collector.Stats().Rejections)
+
+	if machine.Can(cism.Event(3)) || len(calls) != 1 || calls[0] != "guard" || len(kinds) != 0 ||
+		len(collector.Stats().Rejections) != before ||
+		machine.Current() != cism.State(1) || len(machine.History()) != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: probe had side effects: %v %v", name, calls, kinds)
+	}
+}
+
+func shouldCanProbeBranches(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	machine.ProbeGuards = true
+	startErr := machine.Start(cism.State(1))
+
+	if !machine.Can(cism.Event(7)) || machine.Can(cism.Event(8)) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: branches not probed", name)
+	}
+}
+
+func shouldAvailableSorted(t *testing.T, name string) {
+	var calls []string
+
+	for _, compiled := range []bool{false, true} {
+		machine := queryMachine(&calls)
+
+		if compiled {
+			machine.Compiled = machine.States.Compile()
+			machine.States = nil
+		}
+
+		startErr := machine.Start(cism.State(1))
+
+		for i := 0; i < 20; i++ {
+			events := machine.AvailableEvents()
+
+			if len(events) != 5 || events[0] != cism.Event(3) || events[1] != cism.Event(5) ||
+				events[2] != cism.Event(7) || events[3] != cism.Event(8) || events[4] != cism.Event(9) ||
+				startErr != nil {
+				t.Fail()
+				t.Logf("%s: events not sorted: %v", name, events)
+
+				break
+			}
+		}
+	}
+}
+
+func shouldAvailableProbed(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	machine.ProbeGuards = true
+	startErr := machine.Start(cism.State(1))
+	events := machine.AvailableEvents()
+
+	if len(events) != 3 || events[0] != cism.Event(5) || events[1] != cism.Event(7) || events[2] != cism.Event(9) ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: guarded events not left out: %v", name, events)
+	}
+}
+
+func shouldAvailablePaused(t *testing.T, name string) {
+	var calls []string
+	machine := queryMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+
+	if len(machine.AvailableEvents()) != 0 || machine.Can(cism.Event(9)) || startErr != nil || pauseErr != nil {
+		t.Fail()
+		t.Logf("%s: paused machine reported events", name)
+	}
+}
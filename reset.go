@@ -0,0 +1,144 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"time"
+)
+
+/*
+HistoryOption determines what happens to a machine's history log when it is
+reset to a state.
+*/
+type HistoryOption int
+
+const (
+	// ClearHistory clears the history log
+	ClearHistory HistoryOption = iota
+	// KeepHistory keeps the history log, so new records follow the old ones
+	KeepHistory
+	// ArchiveHistory moves the history log into the machine's archive before clearing it
+	ArchiveHistory
+)
+
+/*
+ResetOptions configures how a machine is reset to a state by ResetTo and
+Restart.
+*/
+type ResetOptions struct {
+	Enter   bool          // invokes the entry hook of the target state if true
+	Exit    bool          // invokes the exit hook of the current state if the machine has not stopped and true
+	History HistoryOption // what happens to the history log, cleared by default
+}
+
+/*
+ResetTo resets the machine and starts it again at the given state, whether it
+is running, paused, or stopped. It will return an error if the machine has not
+been started. It will return an error if the given state does not exist in the
+state transition table or is a pseudo-state, in which case the machine is left
+untouched.
+
+The dead letter log, deferred events, and queued events will be cleared, and the
+extended state will be reset to a clone of the machine's initial extended state.
+The history log is cleared, kept, or archived depending on the given options. If
+the machine has not stopped, the exit hook of the current state is invoked with
+NoEvent when the options ask for it, and the entry hook of the given state is
+invoked with NoEvent when the options ask for it. Eventless transitions are then
+taken until the machine reaches a stable state, exactly like Start.
+*/
+func (m *Machine) ResetTo(s State, opts ResetOptions) error {
+	if !m.started {
+		return m.notStarted()
+	}
+
+	if !m.defined(s) || s == AnyState {
+		return &ErrStateNotDefined{s, "reset state not defined in states"}
+	}
+
+	if m.pseudo(s) != RealState {
+		return &ErrStateNotDefined{s, "reset state is a pseudo-state"}
+	}
+
+	from := m.curr
+	d := delivery{ctx: context.Background()}
+
+	if opts.Exit && !m.done {
+		m.exit(from, NoEvent, &d)
+	}
+
+	if m.done {
+		m.donemu.Lock()
+		m.donech = nil
+		m.donemu.Unlock()
+	}
+
+	switch opts.History {
+	case KeepHistory:
+		m.hist.resize(m.HistoryLimit)
+	case ArchiveHistory:
+		m.archive = append(m.archive, m.hist.copy())
+		m.hist.reset()
+		m.hist.init(m.HistoryLimit)
+	default:
+		m.hist.reset()
+		m.hist.init(m.HistoryLimit)
+	}
+
+	m.completed = false
+	m.curr = s
+	m.dead = nil
+	m.deferred = nil
+	m.done = false
+	m.endevt = nil
+	m.ext = cloneExtended(m.Extended)
+	m.paused = false
+	m.queued = nil
+	m.redo = nil
+	m.resend = false
+	m.undofloor = m.hist.total
+
+	m.publish()
+
+	if m.Metrics != nil {
+		m.entered = time.Now()
+	}
+
+	m.logLifecycle("machine reset", s, NoEvent)
+	m.emit(MachineReset, from, s, NoEvent)
+
+	if opts.Enter {
+		m.enter(s, NoEvent, &d)
+	}
+
+	err := m.complete(s, &d)
+
+	m.publish()
+
+	return err
+}
+
+/*
+Restart resets the machine and starts it again at the state it was started at,
+exactly like ResetTo.
+*/
+func (m *Machine) Restart(opts ResetOptions) error {
+	return m.ResetTo(m.initial, opts)
+}
+
+/*
+Archive returns a copy of the history logs archived by resets, oldest first.
+*/
+func (m *Machine) Archive() [][]HistoryRecord {
+	cpyarchive := make([][]HistoryRecord, len(m.archive))
+
+	for i, hist := range m.archive {
+		cpyarchive[i] = make([]HistoryRecord, len(hist))
+
+		copy(cpyarchive[i], hist)
+	}
+
+	return cpyarchive
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_ResetTo(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should err when machine not started":     shouldErrResetToNotStarted,
+		"should err when state not defined":       shouldErrResetToUndefined,
+		"should err when state is a pseudo-state": shouldErrResetToPseudo,
+		"should reset running machine with hooks": shouldResetToWithHooks,
+		"should keep history":                     shouldResetToKeepHistory,
+		"should keep history when limit changes":  shouldResetToKeepHistoryResized,
+		"should archive history":                  shouldResetToArchiveHistory,
+		"should take eventless transitions":       shouldResetToEventless,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_Restart(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should restart completed machine": shouldRestartCompleted,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func recorder(calls *[]string) func(kind string) func(s cism.State, e cism.Event) {
+	return func(kind string) func(s cism.State, e cism.Event) {
+		return func(s cism.State, e cism.Event) {
+			*calls = append(*calls, kind)
+		}
+	}
+}
+
+func hookedMachine(calls *[]string) *cism.Machine {
+	hook := recorder(calls)
+
+	return &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{
+			cism.State(1): {OnEnter: hook("enter1"), OnExit: hook("exit1")},
+			cism.State(2): {OnEnter: hook("enter2"), OnExit: hook("exit2")},
+		},
+		States: finalTable(),
+	}
+}
+
+func shouldErrResetToNotStarted(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	var machineErr *cism.ErrMachineNotStarted
+	err := machine.ResetTo(cism.State(1), cism.ResetOptions{})
+
+	if !errors.As(err, &machineErr) {
+		t.Fail()
+		t.Logf("%s: expected not started error, got %v", name, err)
+	}
+}
+
+func shouldErrResetToUndefined(t *testing.T, name string) {
+	machine := &cism.Machine{States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	var machineErr *cism.ErrStateNotDefined
+	err := machine.ResetTo(cism.State(9), cism.ResetOptions{})
+
+	if !errors.As(err, &machineErr) || machineErr.State != cism.State(9) || machine.Current() != cism.State(2) ||
+		len(machine.History()) != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: expected state not defined error, got %v", name, err)
+	}
+}
+
+func shouldErrResetToPseudo(t *testing.T, name string) {
+	machine := choiceMachine(cism.ChoiceState, func(s cism.State, e cism.Event) bool {
+		return true
+	}, nil)
+	startErr := machine.Start(cism.State(1))
+	var machineErr *cism.ErrStateNotDefined
+	err := machine.ResetTo(cism.State(2), cism.ResetOptions{})
+
+	if !errors.As(err, &machineErr) || machine.Current() != cism.State(1) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: expected state not defined error, got %v", name, err)
+	}
+}
+
+func shouldResetToWithHooks(t *testing.T, name string) {
+	var calls []string
+	machine := hookedMachine(&calls)
+	machine.WhilePaused = cism.PauseQueue
+	startErr := machine.Start(cism.State(1))
+	pauseErr := machine.Pause()
+	sendErr := machine.Send(cism.Event(1))
+	calls = nil
+	err := machine.ResetTo(cism.State(2), cism.ResetOptions{Enter: true, Exit: true})
+
+	if len(calls) != 2 || calls[0] != "exit1" || calls[1] != "enter2" || machine.Current() != cism.State(2) ||
+		machine.Status() != cism.Running || len(machine.Queued()) != 0 || len(machine.History()) != 0 ||
+		err != nil || startErr != nil || pauseErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: running machine not reset: %v %v", name, calls, err)
+	}
+}
+
+func shouldResetToKeepHistory(t *testing.T, name string) {
+	machine := &cism.Machine{HistoryLimit: 4, States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	err := machine.ResetTo(cism.State(1), cism.ResetOptions{History: cism.KeepHistory})
+	sendErr2 := machine.Send(cism.Event(1))
+	hist := machine.History()
+
+	if len(hist) != 2 || hist[0].State != cism.State(1) || hist[1].State != cism.State(1) ||
+		len(machine.Archive()) != 0 || err != nil || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: history not kept: %v", name, hist)
+	}
+}
+
+func shouldResetToKeepHistoryResized(t *testing.T, name string) {
+	machine := &cism.Machine{HistoryLimit: 2, States: benchTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(1))
+	machine.HistoryLimit = 8
+	err := machine.ResetTo(cism.State(1), cism.ResetOptions{History: cism.KeepHistory})
+	sendErr4 := machine.Send(cism.Event(1))
+	hist := machine.History()
+	machine.HistoryLimit = 1
+	err2 := machine.ResetTo(cism.State(1), cism.ResetOptions{History: cism.KeepHistory})
+	hist2 := machine.History()
+
+	if len(hist) != 3 || hist[0].Event != cism.Event(2) || hist[1].Event != cism.Event(1) ||
+		hist[2].State != cism.State(1) || len(hist2) != 1 || hist2[0] != hist[2] || err != nil || err2 != nil ||
+		startErr != nil || sendErr != nil || sendErr2 != nil || sendErr3 != nil || sendErr4 != nil {
+		t.Fail()
+		t.Logf("%s: history not kept: %v %v", name, hist, hist2)
+	}
+}
+
+func shouldResetToArchiveHistory(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	err := machine.ResetTo(cism.State(1), cism.ResetOptions{History: cism.ArchiveHistory})
+	archive := machine.Archive()
+	archive[0][0].Event = cism.Event(9)
+	sendErr2 := machine.Send(cism.Event(1))
+	sendErr3 := machine.Send(cism.Event(3))
+	resetErr := machine.Reset()
+
+	if len(archive) != 1 || len(archive[0]) != 1 || len(machine.Archive()) != 0 ||
+		len(machine.History()) != 0 || err != nil || startErr != nil || sendErr != nil || sendErr2 != nil ||
+		sendErr3 != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: history not archived: %v", name, archive)
+	}
+}
+
+func shouldResetToEventless(t *testing.T, name string) {
+	stt := benchTable()
+	stt[cism.State(3)] = map[cism.Event]*cism.Transition{cism.NoEvent: {To: cism.State(2)}}
+	machine := &cism.Machine{States: stt}
+	startErr := machine.Start(cism.State(1))
+	err := machine.ResetTo(cism.State(3), cism.ResetOptions{})
+	hist := machine.History()
+
+	if machine.Current() != cism.State(2) || len(hist) != 1 || hist[0].State != cism.State(3) || err != nil ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: eventless transitions not taken: %v", name, hist)
+	}
+}
+
+func shouldRestartCompleted(t *testing.T, name string) {
+	var calls []string
+	machine := hookedMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(3))
+	done := machine.Done()
+	calls = nil
+	err := machine.Restart(cism.ResetOptions{Enter: true, Exit: true})
+	renewed := false
+
+	select {
+	case <-machine.Done():
+	default:
+		renewed = true
+	}
+
+	<-done
+
+	if len(calls) != 1 || calls[0] != "enter1" || machine.Current() != cism.State(1) ||
+		machine.Status() != cism.Running || machine.FinalEvent() != nil || !renewed || err != nil ||
+		startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: completed machine not restarted: %v %v", name, calls, err)
+	}
+}
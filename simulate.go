@@ -0,0 +1,72 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import "context"
+
+/*
+SimulateOptions configures how a machine simulates events.
+*/
+type SimulateOptions struct {
+	Guard func(from State, e Event, to State) bool // stub evaluated in place of the guards of guarded transitions, if set
+}
+
+/*
+SimulatedStep represents what a simulated event did to a machine.
+*/
+type SimulatedStep struct {
+	Err     error           // error sending the event would have returned, if any
+	Event   Event           // event that was simulated
+	From    State           // state the machine was in before the event
+	History []HistoryRecord // records the event pushed into the history log, including eventless transitions
+	Outcome string          // outcome of the event, one of the Outcome constants, or empty if it was queued
+	To      State           // state the machine was in after the event
+}
+
+/*
+Simulation represents the trajectory of a machine through simulated events.
+*/
+type Simulation struct {
+	State  State           // state the machine would end up in
+	Status Status          // status the machine would end up with
+	Steps  []SimulatedStep // steps taken, one for each simulated event
+}
+
+/*
+Simulate sends the given events, in order, to a clone of the machine and returns
+the trajectory the clone took, leaving the machine itself untouched. An event
+that would fail to send is recorded with its error and the simulation moves on
+to the next event.
+
+Guards are evaluated as they would be when sending an event, unless the given
+options stub them. Actions, lifecycle hooks other than guards, entry and exit
+hooks, and unhandled event hooks are suppressed, so the extended state does not
+change during a simulation. Interceptors, listeners, logging, metrics, and
+tracing are left out of the simulation as well.
+*/
+func (m *Machine) Simulate(events []Event, opts SimulateOptions) Simulation {
+	c := m.Clone()
+	c.Logger = nil
+	c.Metrics = nil
+	c.Profiling = false
+	c.Tracer = nil
+	c.chain = nil
+	c.sim = &opts
+	steps := make([]SimulatedStep, 0, len(events))
+
+	for _, e := range events {
+		from, total := c.curr, c.hist.total
+		d := delivery{ctx: context.Background()}
+		ok, err := c.admit(d.ctx, e, nil)
+
+		if ok {
+			err = c.dispatch(e, &d, false)
+		}
+
+		steps = append(steps, SimulatedStep{err, e, from, c.hist.since(total), d.result(err), c.curr})
+	}
+
+	return Simulation{c.curr, c.status(), steps}
+}
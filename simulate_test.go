@@ -0,0 +1,153 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_Simulate(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should return trajectory":        shouldSimulateTrajectory,
+		"should suppress actions":         shouldSimulateSuppressActions,
+		"should report rejected guards":   shouldSimulateRejected,
+		"should use stubbed guards":       shouldSimulateStubbedGuards,
+		"should record eventless history": shouldSimulateEventless,
+		"should not touch the machine":    shouldSimulateUntouched,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func simulatedMachine(calls *[]string, guard func(s cism.State, e cism.Event) bool) *cism.Machine {
+	hook := recorder(calls)
+	machine := hookedMachine(calls)
+	machine.Extended = &counter{}
+	machine.OnUnhandled = hook("unhandled")
+	machine.Unhandled = cism.UnhandledHook
+	machine.States[cism.State(1)][cism.Event(1)].Action = cism.TypedAction(
+		func(s cism.State, e cism.Event, c *counter) *counter {
+			*calls = append(*calls, "action")
+
+			return &counter{c.count + 1}
+		})
+	machine.States[cism.State(1)][cism.Event(1)].OnSuccess = hook("success")
+	machine.States[cism.State(2)][cism.Event(2)].Guard = guard
+	machine.States[cism.State(2)][cism.Event(2)].OnFail = hook("fail")
+
+	return machine
+}
+
+func shouldSimulateTrajectory(t *testing.T, name string) {
+	var calls []string
+	machine := simulatedMachine(&calls, nil)
+	startErr := machine.Start(cism.State(1))
+	sim := machine.Simulate([]cism.Event{cism.Event(1), cism.Event(5), cism.Event(2), cism.Event(1), cism.Event(3)},
+		cism.SimulateOptions{})
+
+	if len(sim.Steps) != 5 || sim.State != cism.State(1) || sim.Status != cism.Completed ||
+		sim.Steps[0].From != cism.State(1) || sim.Steps[0].To != cism.State(2) ||
+		sim.Steps[0].Outcome != cism.OutcomeAccepted || len(sim.Steps[0].History) != 1 ||
+		sim.Steps[1].Outcome != cism.OutcomeUnhandled || sim.Steps[1].To != cism.State(2) ||
+		sim.Steps[4].To != cism.State(1) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: wrong trajectory: %v", name, sim)
+	}
+}
+
+func shouldSimulateSuppressActions(t *testing.T, name string) {
+	var calls []string
+	machine := simulatedMachine(&calls, func(s cism.State, e cism.Event) bool {
+		return false
+	})
+	startErr := machine.Start(cism.State(1))
+	calls = nil
+	sim := machine.Simulate([]cism.Event{cism.Event(1), cism.Event(5), cism.Event(2)}, cism.SimulateOptions{})
+
+	if len(calls) != 0 || len(sim.Steps) != 3 || machine.CurrentExtended().(*counter).count != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: actions not suppressed: %v", name, calls)
+	}
+}
+
+func shouldSimulateRejected(t *testing.T, name string) {
+	var calls []string
+	guarded := 0
+	machine := simulatedMachine(&calls, func(s cism.State, e cism.Event) bool {
+		guarded++
+
+		return false
+	})
+	startErr := machine.Start(cism.State(1))
+	sim := machine.Simulate([]cism.Event{cism.Event(1), cism.Event(2)}, cism.SimulateOptions{})
+
+	if guarded != 1 || sim.Steps[1].Outcome != cism.OutcomeRejected || sim.Steps[1].To != cism.State(2) ||
+		len(sim.Steps[1].History) != 0 || sim.Steps[1].Err != nil || startErr != nil {
+		t.Fail()
+		t.Logf("%s: rejected guard not reported: %v", name, sim.Steps)
+	}
+}
+
+func shouldSimulateStubbedGuards(t *testing.T, name string) {
+	var calls []string
+	guarded := 0
+	machine := simulatedMachine(&calls, func(s cism.State, e cism.Event) bool {
+		guarded++
+
+		return false
+	})
+	var stubbed []cism.State
+	startErr := machine.Start(cism.State(1))
+	sim := machine.Simulate([]cism.Event{cism.Event(1), cism.Event(2)}, cism.SimulateOptions{
+		Guard: func(from cism.State, e cism.Event, to cism.State) bool {
+			stubbed = append(stubbed, from, to)
+
+			return true
+		},
+	})
+
+	if guarded != 0 || len(stubbed) != 2 || stubbed[0] != cism.State(2) || stubbed[1] != cism.State(1) ||
+		sim.Steps[1].Outcome != cism.OutcomeAccepted || sim.State != cism.State(1) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: guards not stubbed: %v", name, sim.Steps)
+	}
+}
+
+func shouldSimulateEventless(t *testing.T, name string) {
+	stt := benchTable()
+	stt[cism.State(3)] = map[cism.Event]*cism.Transition{cism.NoEvent: {To: cism.State(1)}}
+	stt[cism.State(2)][cism.Event(3)] = &cism.Transition{To: cism.State(3)}
+	machine := &cism.Machine{States: stt}
+	startErr := machine.Start(cism.State(2))
+	sim := machine.Simulate([]cism.Event{cism.Event(3)}, cism.SimulateOptions{})
+	hist := sim.Steps[0].History
+
+	if len(hist) != 2 || hist[0].To != cism.State(3) || hist[1].To != cism.State(1) || sim.State != cism.State(1) ||
+		startErr != nil {
+		t.Fail()
+		t.Logf("%s: eventless history not recorded: %v", name, hist)
+	}
+}
+
+func shouldSimulateUntouched(t *testing.T, name string) {
+	machine := &cism.Machine{States: finalTable()}
+	notStarted := machine.Simulate([]cism.Event{cism.Event(1)}, cism.SimulateOptions{})
+	startErr := machine.Start(cism.State(1))
+	before := machine.Position()
+	sim := machine.Simulate([]cism.Event{cism.Event(1), cism.Event(3), cism.Event(1)}, cism.SimulateOptions{})
+	var machineErr *cism.ErrMachineStopped
+	var startedErr *cism.ErrMachineNotStarted
+
+	if !errors.As(notStarted.Steps[0].Err, &startedErr) || notStarted.Steps[0].Outcome != cism.OutcomeFailed ||
+		!errors.As(sim.Steps[2].Err, &machineErr) || machine.Position() != before ||
+		len(machine.History()) != 0 || startErr != nil {
+		t.Fail()
+		t.Logf("%s: machine touched by simulation: %v", name, machine.Position())
+	}
+}
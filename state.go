@@ -4,6 +4,8 @@
 
 package cism
 
+import "sort"
+
 /*
 State represents values to be used as state keys in a state transition table.
 */
@@ -15,39 +17,230 @@ transition table.
 */
 type Event int
 
+/*
+AnyState is a wildcard state key for a state transition table. Transitions
+defined for AnyState apply to every state defined in the table. A machine cannot
+be started in AnyState.
+*/
+const AnyState = State(^int(^uint(0) >> 1))
+
+/*
+AnyEvent is a wildcard event key for a state transition table. A transition
+defined for AnyEvent applies to every event sent in that state that has no
+transition of its own.
+*/
+const AnyEvent = Event(^int(^uint(0) >> 1))
+
+/*
+NoEvent is passed to hooks for state changes that are not triggered by a sent
+event, such as entering the start state of a machine. It is also the event key
+for eventless transitions in a state transition table. An eventless transition
+is taken as soon as its state is entered if its guard passes. If its guard
+fails, the machine stays in the state without rejecting the transition, so its
+OnFail hooks are not invoked. NoEvent cannot be sent to a machine, and is never
+matched by AnyEvent.
+*/
+const NoEvent = AnyEvent + 1
+
+/*
+TransitionKind represents how a transition affected the state of a machine.
+*/
+type TransitionKind int
+
+const (
+	// ExternalTransition exits the current state and enters the next state, even if they are the same
+	ExternalTransition TransitionKind = iota
+	// InternalTransition runs its actions without exiting or entering the current state
+	InternalTransition
+	// UndoTransition returns the machine to the state a past transition started from
+	UndoTransition
+	// RedoTransition takes an undone transition again
+	RedoTransition
+	// RollbackTransition returns the machine from a stuck choice to the state it last rested in
+	RollbackTransition
+)
+
 /*
 Transition is the context and lifecycle of a state change for an event in the
 current state.
+
+A transition can define an ordered list of branches for conditional branching.
+When branches are defined, the transition's guards are checked first, then each
+branch is tried in order and the first branch whose Guard, ExtGuard, and
+GuardV2 pass is taken. A branch without guards always passes and acts as a
+default branch. The taken branch's Action, Internal, IsFinal, OnSuccess,
+OnSuccessV2, OnUndo, Reversible, and To are used in place of the transition's
+own. If no branch passes, the transition's OnFail and OnFailV2 are invoked.
+Branches of a branch are not evaluated. A transition with branches has no To of
+its own, so its guards, its failure hooks, and the rejection published to
+listeners are given the state it starts from as the state it goes to.
+
+A transition is external by default, so a transition whose To is the current
+state exits and re-enters that state. An internal transition ignores To and
+runs OnSuccess without exiting or entering the current state.
+
+ExtGuard and Action receive the machine's extended state. A transition passes
+only if both Guard and ExtGuard pass. Action runs right before OnSuccess, and
+the extended state it returns replaces the machine's extended state.
+
+GuardV2, OnFailV2, and OnSuccessV2 are lifecycle hooks with the v2 signature,
+which receive a TransitionContext. Each v2 hook runs after its original
+counterpart, so existing hooks keep working alongside them. A transition passes
+only if GuardV2 returns no error as well. The extended state OnSuccessV2 leaves
+in its transition context replaces the machine's extended state.
+
+A reversible transition can be undone by the machine. OnUndo is its inverse
+hook, which receives a TransitionContext going from the transition's To back to
+the state it started from, and the extended state it leaves in its transition
+context replaces the machine's extended state.
 */
 type Transition struct {
-	Guard     func(s State, e Event) bool // Lifecycle hook for allowing or blocking state change
-	IsFinal   bool                        // Triggers machine done state if true
-	OnFail    func(s State, e Event)      // Lifecycle hook for when Guard blocks state change
-	OnSuccess func(s State, e Event)      // Lifecycle hook for when Guard allows state change
-	To        State                       // State to transition to if Guard allows state change
+	Action      func(s State, e Event, x ExtendedState) ExtendedState // Lifecycle hook for updating extended state
+	Branches    []*Transition                                         // Ordered candidate transitions, first passing Guard wins
+	ExtGuard    func(s State, e Event, x ExtendedState) bool          // Lifecycle hook for guarding with extended state
+	Guard       func(s State, e Event) bool                           // Lifecycle hook for allowing or blocking state change
+	GuardV2     HookFunc                                              // v2 lifecycle hook for allowing or blocking state change
+	Internal    bool                                                  // Stays in the current state without exiting or entering if true
+	IsFinal     bool                                                  // Triggers machine done state if true
+	OnFail      func(s State, e Event)                                // Lifecycle hook for when Guard blocks state change
+	OnFailV2    HookFunc                                              // v2 lifecycle hook for when Guard blocks state change
+	OnSuccess   func(s State, e Event)                                // Lifecycle hook for when Guard allows state change
+	OnSuccessV2 HookFunc                                              // v2 lifecycle hook for when Guard allows state change
+	OnUndo      HookFunc                                              // v2 lifecycle hook for reversing the state change when it is undone
+	Reversible  bool                                                  // Allows the state change to be undone if true
+	To          State                                                 // State to transition to if Guard allows state change
+}
+
+func (t *Transition) hasDefault() bool {
+	if !t.unguarded() {
+		return false
+	}
+
+	if len(t.Branches) == 0 {
+		return !t.Internal
+	}
+
+	for _, branch := range t.Branches {
+		if branch != nil && branch.unguarded() && !branch.Internal {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Transition) unguarded() bool {
+	return t.Guard == nil && t.ExtGuard == nil && t.GuardV2 == nil
+}
+
+func (t *Transition) target(s State) State {
+	if t.Internal || len(t.Branches) > 0 {
+		return s
+	}
+
+	return t.To
+}
+
+/*
+UnhandledPolicy determines how a machine handles an event that has no
+transition in the current state.
+*/
+type UnhandledPolicy int
+
+const (
+	// UnhandledDefault defers to the machine's policy for a state, and errors for a machine
+	UnhandledDefault UnhandledPolicy = iota
+	// UnhandledError makes Send return ErrMissingTransition
+	UnhandledError
+	// UnhandledIgnore drops the event into the dead letter log
+	UnhandledIgnore
+	// UnhandledDefer queues the event to be sent again after the next state change
+	UnhandledDefer
+	// UnhandledHook routes the event to the OnUnhandled hook
+	UnhandledHook
+)
+
+/*
+PseudoKind determines whether a state is a real state a machine can rest in or
+a decision node the machine passes through.
+*/
+type PseudoKind int
+
+const (
+	// RealState is a state a machine can rest in
+	RealState PseudoKind = iota
+	// ChoiceState branches with its eventless transition after the incoming transition's actions run
+	ChoiceState
+	// JunctionState branches with its eventless transition before the incoming transition's actions run
+	JunctionState
+)
+
+/*
+StateConfig is the per-state behavior of a machine. Any property that is not
+set falls back to the machine's own behavior.
+
+A pseudo-state is a reusable decision node defined once and targeted by many
+transitions. Its branches are the branches of its eventless transition, and the
+machine never rests in it.
+*/
+type StateConfig struct {
+	OnEnter     func(s State, e Event) // Hook for when the state is entered by an external transition
+	OnExit      func(s State, e Event) // Hook for when the state is exited by an external transition
+	OnUnhandled func(s State, e Event) // Hook for unhandled events when policy is UnhandledHook
+	Pseudo      PseudoKind             // Kind of decision node the state is, if any
+	Unhandled   UnhandledPolicy        // Policy for events with no transition in the state
 }
 
 /*
 StateTransitionTable is a table mapping transitions to events for each state.
+
+The AnyState and AnyEvent wildcard keys can be used to define transitions that
+apply to many states or events. Exact matches always take precedence over
+wildcards, and a state's own wildcard event takes precedence over the wildcard
+state. The lookup order for a state and event is:
+
+ 1. the state and the event
+ 2. the state and AnyEvent
+ 3. AnyState and the event
+ 4. AnyState and AnyEvent
 */
 type StateTransitionTable map[State]map[Event]*Transition
 
 /*
 GetTransition attempts to return a transition for a given state and event.
-If the state does not exist in the table, it will return nil.
+Wildcard transitions are consulted after exact matches in the order documented
+on StateTransitionTable, except that AnyEvent never matches NoEvent. If the
+state does not exist in the table, it will return nil.
 */
 func (stt StateTransitionTable) GetTransition(s State, e Event) *Transition {
 	if _, ok := stt[s]; !ok {
 		return nil
 	}
 
-	return stt[s][e]
+	if tran := stt[s][e]; tran != nil {
+		return tran
+	}
+
+	if e == NoEvent {
+		return stt[AnyState][e]
+	}
+
+	if tran := stt[s][AnyEvent]; tran != nil {
+		return tran
+	}
+
+	if tran := stt[AnyState][e]; tran != nil {
+		return tran
+	}
+
+	return stt[AnyState][AnyEvent]
 }
 
 /*
-GetEventsForState attempts to return a slice of events for a given state. If
-the state does not exist in the table or no events exist for the given state,
-it will return an empty slice.
+GetEventsForState attempts to return a slice of events for a given state,
+including events defined for AnyState, sorted in ascending order. If the state
+does not exist in the table or no events exist for the given state, it will
+return an empty slice.
 */
 func (stt StateTransitionTable) GetEventsForState(s State) []Event {
 	if _, ok := stt[s]; !ok {
@@ -60,28 +253,52 @@ func (stt StateTransitionTable) GetEventsForState(s State) []Event {
 		events = append(events, event)
 	}
 
+	if s != AnyState {
+		for event, _ := range stt[AnyState] {
+			if _, ok := stt[s][event]; !ok {
+				events = append(events, event)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
 	return events
 }
 
 /*
-GetStatesForEvent attempts to return a slice of states for a given event. If
-the table is empty or no states have the given event, it will return an empty
-slice.
+GetStatesForEvent attempts to return a slice of states for a given event. A
+state has the event if it defines the event or AnyEvent. If AnyState defines the
+event or AnyEvent, every state in the table has the event. AnyEvent never
+matches NoEvent, and AnyState itself is never included. The states are sorted in
+ascending order. If the table is empty or no states have the given event, it
+will return an empty slice.
 */
 func (stt StateTransitionTable) GetStatesForEvent(e Event) []State {
 	if len(stt) == 0 {
 		return nil
 	}
 
+	_, anyEvent := stt[AnyState][e]
+	_, anyAny := stt[AnyState][AnyEvent]
+	anyAny = anyAny && e != NoEvent
 	var states []State
 
 	for state, events := range stt {
-		for event, _ := range events {
-			if event == e {
-				states = append(states, state)
-			}
+		if state == AnyState {
+			continue
+		}
+
+		_, hasEvent := events[e]
+		_, hasAny := events[AnyEvent]
+		hasAny = hasAny && e != NoEvent
+
+		if hasEvent || hasAny || anyEvent || anyAny {
+			states = append(states, state)
 		}
 	}
 
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
 	return states
 }
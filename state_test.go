@@ -14,6 +14,10 @@ func TestStateTransitionTable_GetTransition(t *testing.T) {
 		"should be nil when table is empty":                shouldBeNilTranEmptyTable,
 		"should be nil when state is missing":              shouldBeNilTranMissingState,
 		"should exist when state and event match in table": shouldExistTranOnMatch,
+		"should prefer exact match over wildcards":         shouldPreferExactTranOverWildcard,
+		"should fall back to wildcard event for state":     shouldFallBackTranAnyEvent,
+		"should fall back to wildcard state":               shouldFallBackTranAnyState,
+		"should not match wildcard event for no event":     shouldBeNilTranAnyEventNoEvent,
 	}
 
 	for name, test := range testCases {
@@ -26,6 +30,8 @@ func TestStateTransitionTable_GetEventsForState(t *testing.T) {
 		"should be empty when state is missing":    shouldBeEmptyEventsMissingState,
 		"should be empty when state has no events": shouldBeEmptyEventsNoEvents,
 		"should exist when state has events":       shouldExistEventsOnMatch,
+		"should include wildcard state events":     shouldIncludeEventsAnyState,
+		"should sort events":                       shouldSortEvents,
 	}
 
 	for name, test := range testCases {
@@ -38,6 +44,8 @@ func TestStateTransitionTable_GetStatesForEvent(t *testing.T) {
 		"should be empty when table is empty":      shouldBeEmptyStatesEmptyTable,
 		"should be empty when event has no states": shouldBeEmptyStatesNoStates,
 		"should exist when event has states":       shouldExistStatesOnMatch,
+		"should have all states for wildcard":      shouldExistStatesAnyState,
+		"should sort states":                       shouldSortStates,
 	}
 
 	for name, test := range testCases {
@@ -77,6 +85,61 @@ func shouldExistTranOnMatch(t *testing.T, name string) {
 	}
 }
 
+func shouldPreferExactTranOverWildcard(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	tran := &cism.Transition{}
+	stt := cism.StateTransitionTable{
+		state:         {event: tran, cism.AnyEvent: &cism.Transition{}},
+		cism.AnyState: {event: &cism.Transition{}},
+	}
+
+	if stt.GetTransition(state, event) != tran {
+		t.Fail()
+		t.Logf("%s: incorrect transaction returned", name)
+	}
+}
+
+func shouldFallBackTranAnyEvent(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	tran := &cism.Transition{}
+	stt := cism.StateTransitionTable{
+		state:         {cism.AnyEvent: tran},
+		cism.AnyState: {event: &cism.Transition{}},
+	}
+
+	if stt.GetTransition(state, event) != tran {
+		t.Fail()
+		t.Logf("%s: incorrect transaction returned", name)
+	}
+}
+
+func shouldFallBackTranAnyState(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	tran := &cism.Transition{}
+	stt := cism.StateTransitionTable{
+		state:         {cism.Event(2): &cism.Transition{}},
+		cism.AnyState: {event: tran},
+	}
+
+	if stt.GetTransition(state, event) != tran || stt.GetTransition(state, cism.Event(3)) != nil {
+		t.Fail()
+		t.Logf("%s: incorrect transaction returned", name)
+	}
+}
+
+func shouldBeNilTranAnyEventNoEvent(t *testing.T, name string) {
+	state := cism.State(1)
+	stt := cism.StateTransitionTable{state: {cism.AnyEvent: &cism.Transition{}}}
+
+	if stt.GetTransition(state, cism.NoEvent) != nil {
+		t.Fail()
+		t.Logf("%s: result not nil", name)
+	}
+}
+
 func shouldBeEmptyEventsMissingState(t *testing.T, name string) {
 	state := cism.State(1)
 	stt := cism.StateTransitionTable{cism.State(2): {cism.Event(1): nil}}
@@ -108,6 +171,37 @@ func shouldExistEventsOnMatch(t *testing.T, name string) {
 	}
 }
 
+func shouldIncludeEventsAnyState(t *testing.T, name string) {
+	state := cism.State(1)
+	event := cism.Event(1)
+	stt := cism.StateTransitionTable{state: {event: nil}, cism.AnyState: {event: nil, cism.Event(2): nil}}
+
+	if len(stt.GetEventsForState(state)) != 2 {
+		t.Fail()
+		t.Logf("%s: incorrect events returned", name)
+	}
+}
+
+func shouldSortEvents(t *testing.T, name string) {
+	state := cism.State(1)
+	stt := cism.StateTransitionTable{
+		state:         {cism.Event(9): nil, cism.Event(3): nil, cism.Event(7): nil},
+		cism.AnyState: {cism.Event(5): nil, cism.Event(1): nil},
+	}
+
+	for i := 0; i < 20; i++ {
+		events := stt.GetEventsForState(state)
+
+		if len(events) != 5 || events[0] != cism.Event(1) || events[1] != cism.Event(3) ||
+			events[2] != cism.Event(5) || events[3] != cism.Event(7) || events[4] != cism.Event(9) {
+			t.Fail()
+			t.Logf("%s: events not sorted: %v", name, events)
+
+			return
+		}
+	}
+}
+
 func shouldBeEmptyStatesEmptyTable(t *testing.T, name string) {
 	event := cism.Event(1)
 	stt := cism.StateTransitionTable{}
@@ -139,3 +233,35 @@ func shouldExistStatesOnMatch(t *testing.T, name string) {
 		t.Logf("%s: result empty", name)
 	}
 }
+
+func shouldExistStatesAnyState(t *testing.T, name string) {
+	event := cism.Event(1)
+	stt := cism.StateTransitionTable{cism.State(1): {}, cism.State(2): {}, cism.AnyState: {event: nil}}
+
+	if len(stt.GetStatesForEvent(event)) != 2 {
+		t.Fail()
+		t.Logf("%s: incorrect states returned", name)
+	}
+}
+
+func shouldSortStates(t *testing.T, name string) {
+	event := cism.Event(1)
+	stt := cism.StateTransitionTable{
+		cism.State(8): {event: nil},
+		cism.State(2): {cism.AnyEvent: nil},
+		cism.State(5): {event: nil},
+		cism.State(3): {},
+	}
+
+	for i := 0; i < 20; i++ {
+		states := stt.GetStatesForEvent(event)
+
+		if len(states) != 3 || states[0] != cism.State(2) || states[1] != cism.State(5) ||
+			states[2] != cism.State(8) {
+			t.Fail()
+			t.Logf("%s: states not sorted: %v", name, states)
+
+			return
+		}
+	}
+}
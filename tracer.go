@@ -0,0 +1,174 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Span is a timed operation of a machine, such as sending an event, with
+attributes describing it. Implement it to adapt any tracing SDK.
+*/
+type Span interface {
+	SetAttribute(key string, value string) // sets an attribute of the span
+	End()                                  // ends the span
+}
+
+/*
+Tracer starts spans. The context a tracer returns carries the new span, so spans
+started with it are children of the new span. Implement it to adapt any tracing
+SDK.
+*/
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+/*
+The names of the spans a machine starts. A send span covers a whole send,
+including interceptors, and guard and action spans are its children.
+*/
+const (
+	SendSpan   = "cism.send"
+	GuardSpan  = "cism.guard"
+	ActionSpan = "cism.action"
+)
+
+/*
+The outcomes a send span's outcome attribute can hold.
+*/
+const (
+	OutcomeAccepted  = "accepted"
+	OutcomeRejected  = "rejected"
+	OutcomeUnhandled = "unhandled"
+	OutcomeFailed    = "failed"
+)
+
+/*
+NoopTracer is a tracer whose spans do nothing. A machine without a tracer traces
+nothing, as if it used a NoopTracer.
+*/
+type NoopTracer struct{}
+
+/*
+Start returns the given context and a span that does nothing.
+*/
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value string) {}
+
+func (noopSpan) End() {}
+
+/*
+RecordedSpan represents a span started by a recorder.
+*/
+type RecordedSpan struct {
+	Attributes map[string]string // attributes set on the span
+	Ended      bool              // whether the span has ended
+	Name       string            // name of the span
+	Parent     int               // index of the parent span in the recorder, or -1 if the span has no parent
+}
+
+/*
+Recorder is a tracer that keeps the spans it starts in memory, such as for
+tests. It is safe for concurrent use.
+*/
+type Recorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+type recorderKey struct{}
+
+type recorderSpan struct {
+	index int
+	r     *Recorder
+}
+
+/*
+Start starts a recorded span, which is a child of the recorder's span in the
+given context, if any.
+*/
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := -1
+
+	if ps, ok := ctx.Value(recorderKey{}).(*recorderSpan); ok && ps.r == r {
+		parent = ps.index
+	}
+
+	r.mu.Lock()
+	span := &recorderSpan{len(r.spans), r}
+	r.spans = append(r.spans, RecordedSpan{map[string]string{}, false, name, parent})
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, recorderKey{}, span), span
+}
+
+/*
+Spans returns a copy of the spans the recorder has started, in the order they
+were started.
+*/
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cpyspans := make([]RecordedSpan, len(r.spans))
+
+	for i, span := range r.spans {
+		cpyspans[i] = span
+		cpyspans[i].Attributes = make(map[string]string, len(span.Attributes))
+
+		for key, value := range span.Attributes {
+			cpyspans[i].Attributes[key] = value
+		}
+	}
+
+	return cpyspans
+}
+
+func (s *recorderSpan) SetAttribute(key string, value string) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	s.r.spans[s.index].Attributes[key] = value
+}
+
+func (s *recorderSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	s.r.spans[s.index].Ended = true
+}
+
+func (m *Machine) startSpan(d *delivery, name string, from State, e Event) (context.Context, Span) {
+	ctx := d.ctx
+	var span Span
+	d.ctx, span = m.Tracer.Start(ctx, name)
+
+	span.SetAttribute("from", m.Names.State(from))
+	span.SetAttribute("event", m.Names.Event(e))
+
+	return ctx, span
+}
+
+func (m *Machine) endSend(span Span, d *delivery, err error) {
+	outcome := d.result(err)
+
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+	}
+
+	if outcome != "" {
+		span.SetAttribute("outcome", outcome)
+	}
+
+	span.SetAttribute("to", m.Names.State(m.curr))
+	span.End()
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"context"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_Tracer(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should span send with guard and action":  shouldSpanSend,
+		"should span rejected send":               shouldSpanRejected,
+		"should span unhandled send":              shouldSpanUnhandled,
+		"should propagate trace context to hooks": shouldPropagateSpan,
+		"should span send through interceptors":   shouldSpanIntercepted,
+		"should send with no-op tracer":           shouldSendNoopTracer,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func tracedMachine(tracer cism.Tracer) *cism.Machine {
+	return &cism.Machine{
+		States: cism.StateTransitionTable{
+			cism.State(1): {
+				cism.Event(1): &cism.Transition{
+					Guard:     func(s cism.State, e cism.Event) bool { return true },
+					OnSuccess: func(s cism.State, e cism.Event) {},
+					To:        cism.State(2),
+				},
+				cism.Event(2): &cism.Transition{
+					Guard: func(s cism.State, e cism.Event) bool { return false },
+					To:    cism.State(2),
+				},
+			},
+			cism.State(2): {},
+		},
+		Tracer: tracer,
+	}
+}
+
+func shouldSpanSend(t *testing.T, name string) {
+	recorder := &cism.Recorder{}
+	machine := tracedMachine(recorder)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	spans := recorder.Spans()
+
+	if len(spans) != 3 || spans[0].Name != cism.SendSpan || spans[0].Parent != -1 ||
+		spans[0].Attributes["from"] != "1" || spans[0].Attributes["to"] != "2" || spans[0].Attributes["event"] != "1" ||
+		spans[0].Attributes["outcome"] != cism.OutcomeAccepted || spans[1].Name != cism.GuardSpan ||
+		spans[1].Parent != 0 || spans[1].Attributes["passed"] != "true" || spans[2].Name != cism.ActionSpan ||
+		spans[2].Parent != 0 || spans[2].Attributes["to"] != "2" || !spans[0].Ended || !spans[1].Ended ||
+		!spans[2].Ended || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: send not spanned: %v", name, spans)
+	}
+}
+
+func shouldSpanRejected(t *testing.T, name string) {
+	recorder := &cism.Recorder{}
+	machine := tracedMachine(recorder)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	spans := recorder.Spans()
+
+	if len(spans) != 2 || spans[0].Attributes["outcome"] != cism.OutcomeRejected || spans[0].Attributes["to"] != "1" ||
+		spans[1].Attributes["passed"] != "false" || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: rejected send not spanned: %v", name, spans)
+	}
+}
+
+func shouldSpanUnhandled(t *testing.T, name string) {
+	recorder := &cism.Recorder{}
+	machine := tracedMachine(recorder)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(3))
+	spans := recorder.Spans()
+
+	if len(spans) != 1 || spans[0].Attributes["outcome"] != cism.OutcomeUnhandled ||
+		spans[0].Attributes["error"] == "" || startErr != nil || sendErr == nil {
+		t.Fail()
+		t.Logf("%s: unhandled send not spanned: %v", name, spans)
+	}
+}
+
+func shouldPropagateSpan(t *testing.T, name string) {
+	recorder := &cism.Recorder{}
+	machine := tracedMachine(recorder)
+	tran := machine.States[cism.State(1)][cism.Event(1)]
+	tran.GuardV2 = func(tc *cism.TransitionContext) error {
+		_, span := recorder.Start(tc.Ctx, "guard work")
+		span.End()
+
+		return nil
+	}
+	tran.OnSuccessV2 = func(tc *cism.TransitionContext) error {
+		_, span := recorder.Start(tc.Ctx, "action work")
+		span.End()
+
+		return nil
+	}
+	ctx, parent := recorder.Start(context.Background(), "request")
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.SendContext(ctx, cism.Event(1))
+	parent.End()
+	spans := recorder.Spans()
+
+	if len(spans) != 6 || spans[1].Name != cism.SendSpan || spans[1].Parent != 0 || spans[3].Name != "guard work" ||
+		spans[3].Parent != 2 || spans[5].Name != "action work" || spans[5].Parent != 4 || startErr != nil ||
+		sendErr != nil {
+		t.Fail()
+		t.Logf("%s: trace context not propagated: %v", name, spans)
+	}
+}
+
+func shouldSpanIntercepted(t *testing.T, name string) {
+	recorder := &cism.Recorder{}
+	machine := tracedMachine(recorder)
+	machine.Use(func(next cism.Handler) cism.Handler {
+		return func(req *cism.Request) error {
+			_, span := recorder.Start(req.Ctx, "interceptor")
+			defer span.End()
+
+			return next(req)
+		}
+	})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(2))
+	spans := recorder.Spans()
+
+	if len(spans) != 3 || spans[1].Name != "interceptor" || spans[1].Parent != 0 ||
+		spans[0].Attributes["outcome"] != cism.OutcomeRejected || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: intercepted send not spanned: %v", name, spans)
+	}
+}
+
+func shouldSendNoopTracer(t *testing.T, name string) {
+	machine := tracedMachine(cism.NoopTracer{})
+	startErr := machine.Start(cism.State(1))
+
+	if err := machine.Send(cism.Event(1)); err != nil || startErr != nil || machine.Current() != cism.State(2) {
+		t.Fail()
+		t.Logf("%s: machine did not send", name)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Undo returns the machine to the state its most recent transition started from.
+It will return an error if the machine has not been started, has been stopped,
+or is paused. It will return an error if there is no transition left to undo,
+or if the transition is not reversible, in which case the machine is left
+untouched.
+
+An undone external transition exits the current state and enters the state it
+returns to, and an undone internal transition does neither. The transition's
+OnUndo hook runs in between, and it will return an error if OnUndo returns an
+error. A sent event and the eventless transitions that followed it, including
+those through pseudo-states, are undone together as one step, so the machine is
+returned to a stable state. Eventless transitions are not taken after an undo,
+and transitions taken by Start or a reset cannot be undone.
+
+Every undone transition is pushed into the history log as an UndoTransition
+record, and can be taken again with Redo until another transition is taken.
+Transitions that were rolled back out of a stuck choice are skipped, and
+transitions from before a reset that kept the history log cannot be undone.
+*/
+func (m *Machine) Undo() error {
+	if err := m.rewindable(); err != nil {
+		return err
+	}
+
+	recs, err := m.undoable(-1)
+
+	if err != nil {
+		return err
+	}
+
+	if len(recs) == 0 {
+		return &ErrNotReversible{m.curr, NoEvent, "no transition to undo"}
+	}
+
+	return m.rewind(recs)
+}
+
+/*
+Redo takes the most recently undone transition again. It will return an error
+if the machine has not been started, has been stopped, or is paused. It will
+return an error if there is no undone transition to take again.
+
+A redone transition exits and enters states exactly like the original
+transition, and runs its Action, OnSuccess, and OnSuccessV2 hooks again without
+evaluating its guards. The eventless transitions that were undone along with it
+are taken again as well. Every redone transition is pushed into the history log
+as a RedoTransition record.
+*/
+func (m *Machine) Redo() error {
+	if err := m.rewindable(); err != nil {
+		return err
+	}
+
+	if len(m.redo) == 0 {
+		return &ErrNotReversible{m.curr, NoEvent, "no transition to redo"}
+	}
+
+	d := delivery{ctx: context.Background()}
+
+	for len(m.redo) > 0 {
+		rec := m.redo[len(m.redo)-1]
+		m.redo = m.redo[:len(m.redo)-1]
+
+		m.retake(rec, m.taken(rec), &d)
+
+		if len(m.redo) == 0 || m.redo[len(m.redo)-1].Event != NoEvent {
+			break
+		}
+	}
+
+	m.publish()
+
+	return d.err
+}
+
+/*
+RewindTo undoes every transition at or after the given index of the history
+log that has not already been undone, most recent first, exactly like Undo, so
+the machine returns to the state it was in before that index. It will return an
+error if the index is outside of the history log. It will return an error if any
+of the transitions is not reversible, in which case the machine is left
+untouched.
+*/
+func (m *Machine) RewindTo(index int) error {
+	if err := m.rewindable(); err != nil {
+		return err
+	}
+
+	if index < 0 || index >= m.hist.len() {
+		return &ErrInvalidIndex{index, "index outside of history log"}
+	}
+
+	if index < m.floor() {
+		return &ErrInvalidIndex{index, "index before the machine was last reset"}
+	}
+
+	recs, err := m.undoable(index)
+
+	if err != nil {
+		return err
+	}
+
+	return m.rewind(recs)
+}
+
+func (m *Machine) rewindable() error {
+	if !m.started {
+		return m.notStarted()
+	}
+
+	if m.done {
+		return m.stopped()
+	}
+
+	if m.paused {
+		return &ErrMachinePaused{m.curr, NoEvent, "machine is paused and cannot rewind"}
+	}
+
+	return nil
+}
+
+func (m *Machine) undoable(index int) ([]HistoryRecord, error) {
+	var recs []HistoryRecord
+	skip := 0
+	rolled := false
+
+	for i := m.hist.len() - 1; i >= 0 && i >= m.floor(); i-- {
+		rec := m.hist.at(i)
+
+		if rec.Kind == UndoTransition {
+			skip++
+
+			continue
+		}
+
+		if rec.Kind == RollbackTransition {
+			rolled = true
+
+			continue
+		}
+
+		if rolled {
+			rolled = m.pseudo(rec.State) != RealState
+
+			continue
+		}
+
+		if skip > 0 {
+			skip--
+
+			continue
+		}
+
+		if i < index && m.settled(recs) {
+			break
+		}
+
+		if tran := m.taken(rec); tran == nil || !tran.Reversible {
+			return nil, &ErrNotReversible{rec.State, rec.Event, "transition is not reversible"}
+		}
+
+		recs = append(recs, rec)
+
+		if index < 0 && m.settled(recs) {
+			break
+		}
+	}
+
+	if !m.settled(recs) {
+		return nil, &ErrNotReversible{m.curr, NoEvent, "no stable state to undo to"}
+	}
+
+	return recs, nil
+}
+
+func (m *Machine) settled(recs []HistoryRecord) bool {
+	if len(recs) == 0 {
+		return true
+	}
+
+	rec := recs[len(recs)-1]
+
+	return rec.Event != NoEvent && m.pseudo(rec.State) == RealState
+}
+
+func (m *Machine) floor() int {
+	return m.undofloor - (m.hist.total - m.hist.len())
+}
+
+func (m *Machine) rewind(recs []HistoryRecord) error {
+	d := delivery{ctx: context.Background()}
+
+	for _, rec := range recs {
+		m.reverse(rec, m.taken(rec), &d)
+	}
+
+	m.publish()
+
+	return d.err
+}
+
+func (m *Machine) taken(rec HistoryRecord) *Transition {
+	tran := m.lookup(rec.State, rec.Event)
+
+	if tran != nil && rec.Branch >= 0 {
+		if rec.Branch >= len(tran.Branches) {
+			return nil
+		}
+
+		tran = tran.Branches[rec.Branch]
+	}
+
+	return tran
+}
+
+func (m *Machine) reverse(rec HistoryRecord, tran *Transition, d *delivery) {
+	if !tran.Internal {
+		m.exit(rec.To, rec.Event, d)
+		m.dwell(rec.To)
+	}
+
+	m.hist.push(HistoryRecord{rec.To, rec.Event, rec.State, rec.Branch, UndoTransition})
+	m.curr = rec.State
+	m.redo = append(m.redo, rec)
+
+	m.track()
+
+	m.logTransition(d.ctx, "transition undone", rec.To, rec.State, rec.Event, true)
+
+	if tran.OnUndo != nil {
+		start := m.hookStart(d.ctx, rec.To, rec.Event)
+		tc := m.context(rec.To, rec.State, rec.Event, d)
+		err := tran.OnUndo(tc)
+		m.ext = tc.Extended
+		m.hookEnd(d.ctx, "OnUndo", rec.To, rec.Event, start)
+
+		if err != nil {
+			d.fail(&ErrHookFailed{rec.To, rec.Event, err, "transition undo hook returned an error"})
+		}
+	}
+
+	if !tran.Internal {
+		m.enter(rec.State, rec.Event, d)
+	}
+
+	m.emit(TransitionUndone, rec.To, rec.State, rec.Event)
+}
+
+func (m *Machine) retake(rec HistoryRecord, tran *Transition, d *delivery) {
+	if !tran.Internal {
+		m.exit(rec.State, rec.Event, d)
+		m.dwell(rec.State)
+	}
+
+	m.hist.push(HistoryRecord{rec.State, rec.Event, rec.To, rec.Branch, RedoTransition})
+	m.curr = rec.To
+
+	m.track()
+
+	m.logTransition(d.ctx, "transition redone", rec.State, rec.To, rec.Event, true)
+	m.actions(tran, rec.State, rec.To, rec.Event, d)
+
+	if !tran.Internal {
+		m.enter(rec.To, rec.Event, d)
+	}
+
+	m.emit(TransitionRedone, rec.State, rec.To, rec.Event)
+}
+
+func (m *Machine) dwell(s State) {
+	if m.Metrics != nil {
+		now := time.Now()
+
+		m.Metrics.Dwell(s, now.Sub(m.entered))
+
+		m.entered = now
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2020 Stephen Buckler. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package cism_test
+
+import (
+	"errors"
+	"github.com/sebuckler/cism"
+	"testing"
+)
+
+func TestMachine_Undo(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should undo external transition":       shouldUndoExternal,
+		"should undo internal transition":       shouldUndoInternal,
+		"should undo several transitions":       shouldUndoSeveral,
+		"should undo through junction":          shouldUndoJunction,
+		"should undo eventless chain with send": shouldUndoEventless,
+		"should err when not reversible":        shouldErrUndoNotReversible,
+		"should err when nothing to undo":       shouldErrUndoNothing,
+		"should err when machine paused":        shouldErrUndoPaused,
+		"should err for transitions past reset": shouldErrUndoPastReset,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_Redo(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should redo undone transition":       shouldRedoUndone,
+		"should clear redo on new transition": shouldClearRedo,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func TestMachine_RewindTo(t *testing.T) {
+	testCases := map[string]func(t *testing.T, name string){
+		"should rewind to history index":        shouldRewindToIndex,
+		"should err when index out of range":    shouldErrRewindIndex,
+		"should not rewind when not reversible": shouldNotRewindIrreversible,
+	}
+
+	for name, test := range testCases {
+		test(t, name)
+	}
+}
+
+func undoMachine(calls *[]string) *cism.Machine {
+	count := cism.TypedAction(func(s cism.State, e cism.Event, c *counter) *counter {
+		return &counter{c.count + 1}
+	})
+	uncount := func(tc *cism.TransitionContext) error {
+		*calls = append(*calls, "undo")
+		tc.Extended = &counter{tc.Extended.(*counter).count - 1}
+
+		return nil
+	}
+	machine := hookedMachine(calls)
+	machine.Extended = &counter{}
+	machine.States = cism.StateTransitionTable{
+		cism.State(1): {
+			cism.Event(1): {Action: count, OnUndo: uncount, Reversible: true, To: cism.State(2)},
+			cism.Event(3): {To: cism.State(2)},
+			cism.Event(4): {Action: count, Internal: true, OnUndo: uncount, Reversible: true},
+		},
+		cism.State(2): {
+			cism.Event(2): {Reversible: true, To: cism.State(1)},
+		},
+	}
+
+	return machine
+}
+
+func shouldUndoExternal(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	var kinds []cism.TransitionEventKind
+	machine.AddListener(func(ev cism.TransitionEvent) {
+		kinds = append(kinds, ev.Kind)
+	})
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	calls = nil
+	err := machine.Undo()
+	hist := machine.History()
+
+	if len(calls) != 3 || calls[0] != "exit2" || calls[1] != "undo" || calls[2] != "enter1" ||
+		machine.Current() != cism.State(1) || machine.CurrentExtended().(*counter).count != 0 || len(hist) != 2 ||
+		hist[1] != (cism.HistoryRecord{State: cism.State(2), Event: cism.Event(1), To: cism.State(1), Branch: -1,
+			Kind: cism.UndoTransition}) || kinds[len(kinds)-1] != cism.TransitionUndone || err != nil ||
+		startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: transition not undone: %v %v %v", name, calls, hist, err)
+	}
+}
+
+func shouldUndoInternal(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(4))
+	calls = nil
+	err := machine.Undo()
+
+	if len(calls) != 1 || calls[0] != "undo" || machine.Current() != cism.State(1) ||
+		machine.CurrentExtended().(*counter).count != 0 || err != nil || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: internal transition not undone: %v %v", name, calls, err)
+	}
+}
+
+func shouldUndoSeveral(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(1))
+	undoErr := machine.Undo()
+	undoErr2 := machine.Undo()
+	current := machine.Current()
+	undoErr3 := machine.Undo()
+	var machineErr *cism.ErrNotReversible
+	err := machine.Undo()
+
+	if !errors.As(err, &machineErr) || current != cism.State(2) || machine.Current() != cism.State(1) ||
+		machine.CurrentExtended().(*counter).count != 0 || len(machine.History()) != 6 || startErr != nil ||
+		sendErr != nil || sendErr2 != nil || sendErr3 != nil || undoErr != nil || undoErr2 != nil ||
+		undoErr3 != nil {
+		t.Fail()
+		t.Logf("%s: transitions not undone: %v", name, machine.History())
+	}
+}
+
+func shouldUndoJunction(t *testing.T, name string) {
+	machine := &cism.Machine{
+		Configs: map[cism.State]*cism.StateConfig{cism.State(3): {Pseudo: cism.JunctionState}},
+		States: cism.StateTransitionTable{
+			cism.State(1): {cism.Event(1): {Reversible: true, To: cism.State(3)}},
+			cism.State(2): {},
+			cism.State(3): {cism.NoEvent: {Reversible: true, To: cism.State(2)}},
+		},
+	}
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	err := machine.Undo()
+	undone := machine.Current()
+	redoErr := machine.Redo()
+	hist := machine.History()
+
+	if undone != cism.State(1) || machine.Current() != cism.State(2) || len(hist) != 6 ||
+		hist[2].Kind != cism.UndoTransition || hist[3].Kind != cism.UndoTransition ||
+		hist[5].Kind != cism.RedoTransition || err != nil || startErr != nil || sendErr != nil || redoErr != nil {
+		t.Fail()
+		t.Logf("%s: junction not undone: %v", name, hist)
+	}
+}
+
+func shouldUndoEventless(t *testing.T, name string) {
+	machine := &cism.Machine{States: cism.StateTransitionTable{
+		cism.State(1): {cism.Event(1): {Reversible: true, To: cism.State(2)}},
+		cism.State(2): {cism.NoEvent: {Reversible: true, To: cism.State(3)}},
+		cism.State(3): {},
+	}}
+	startErr := machine.Start(cism.State(2))
+	var machineErr *cism.ErrNotReversible
+	startUndoErr := machine.Undo()
+	resetErr := machine.ResetTo(cism.State(1), cism.ResetOptions{})
+	sendErr := machine.Send(cism.Event(1))
+	err := machine.Undo()
+	undone := machine.Current()
+	redoErr := machine.Redo()
+	hist := machine.History()
+
+	if !errors.As(startUndoErr, &machineErr) || undone != cism.State(1) || machine.Current() != cism.State(3) ||
+		len(hist) != 6 || hist[2].Kind != cism.UndoTransition || hist[3].Kind != cism.UndoTransition ||
+		hist[5].Kind != cism.RedoTransition || err != nil || startErr != nil || resetErr != nil || sendErr != nil ||
+		redoErr != nil {
+		t.Fail()
+		t.Logf("%s: eventless chain not undone with its send: %v", name, hist)
+	}
+}
+
+func shouldErrUndoNotReversible(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(3))
+	var machineErr *cism.ErrNotReversible
+	err := machine.Undo()
+
+	if !errors.As(err, &machineErr) || machineErr.State != cism.State(1) || machineErr.Event != cism.Event(3) ||
+		machine.Current() != cism.State(2) || len(machine.History()) != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: expected not reversible error, got %v", name, err)
+	}
+}
+
+func shouldErrUndoNothing(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	var machineErr *cism.ErrNotReversible
+	err := machine.Undo()
+	var redoErr *cism.ErrNotReversible
+	err2 := machine.Redo()
+
+	if !errors.As(err, &machineErr) || !errors.As(err2, &redoErr) || startErr != nil {
+		t.Fail()
+		t.Logf("%s: expected not reversible errors, got %v %v", name, err, err2)
+	}
+}
+
+func shouldErrUndoPaused(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	pauseErr := machine.Pause()
+	var machineErr *cism.ErrMachinePaused
+	err := machine.Undo()
+
+	if !errors.As(err, &machineErr) || machine.Current() != cism.State(2) || startErr != nil || sendErr != nil ||
+		pauseErr != nil {
+		t.Fail()
+		t.Logf("%s: expected paused error, got %v", name, err)
+	}
+}
+
+func shouldErrUndoPastReset(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	resetErr := machine.ResetTo(cism.State(1), cism.ResetOptions{History: cism.KeepHistory})
+	var machineErr *cism.ErrNotReversible
+	err := machine.Undo()
+	var indexErr *cism.ErrInvalidIndex
+	err2 := machine.RewindTo(0)
+
+	if !errors.As(err, &machineErr) || !errors.As(err2, &indexErr) || machine.Current() != cism.State(1) ||
+		startErr != nil || sendErr != nil || resetErr != nil {
+		t.Fail()
+		t.Logf("%s: expected errors, got %v %v", name, err, err2)
+	}
+}
+
+func shouldRedoUndone(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	undoErr := machine.Undo()
+	calls = nil
+	err := machine.Redo()
+	redone := calls
+	hist := machine.History()
+	undoErr2 := machine.Undo()
+
+	if len(redone) != 2 || redone[0] != "exit1" || redone[1] != "enter2" || len(hist) != 3 ||
+		hist[2] != (cism.HistoryRecord{State: cism.State(1), Event: cism.Event(1), To: cism.State(2), Branch: -1,
+			Kind: cism.RedoTransition}) || machine.Current() != cism.State(1) ||
+		machine.CurrentExtended().(*counter).count != 0 || err != nil || startErr != nil || sendErr != nil ||
+		undoErr != nil || undoErr2 != nil {
+		t.Fail()
+		t.Logf("%s: transition not redone: %v %v", name, redone, hist)
+	}
+}
+
+func shouldClearRedo(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	undoErr := machine.Undo()
+	sendErr2 := machine.Send(cism.Event(4))
+	var machineErr *cism.ErrNotReversible
+	err := machine.Redo()
+
+	if !errors.As(err, &machineErr) || machine.Current() != cism.State(1) || startErr != nil || sendErr != nil ||
+		undoErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: expected not reversible error, got %v", name, err)
+	}
+}
+
+func shouldRewindToIndex(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	sendErr2 := machine.Send(cism.Event(2))
+	sendErr3 := machine.Send(cism.Event(1))
+	err := machine.RewindTo(1)
+	hist := machine.History()
+	redoErr := machine.Redo()
+
+	if machine.Current() != cism.State(1) || len(hist) != 5 || hist[3].To != cism.State(1) ||
+		hist[4].To != cism.State(2) || hist[4].Kind != cism.UndoTransition || err != nil || startErr != nil ||
+		sendErr != nil || sendErr2 != nil || sendErr3 != nil || redoErr != nil {
+		t.Fail()
+		t.Logf("%s: not rewound: %v %v", name, hist, err)
+	}
+}
+
+func shouldErrRewindIndex(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(1))
+	var machineErr *cism.ErrInvalidIndex
+	err := machine.RewindTo(1)
+
+	if !errors.As(err, &machineErr) || machineErr.Index != 1 || startErr != nil || sendErr != nil {
+		t.Fail()
+		t.Logf("%s: expected invalid index error, got %v", name, err)
+	}
+}
+
+func shouldNotRewindIrreversible(t *testing.T, name string) {
+	var calls []string
+	machine := undoMachine(&calls)
+	startErr := machine.Start(cism.State(1))
+	sendErr := machine.Send(cism.Event(3))
+	sendErr2 := machine.Send(cism.Event(2))
+	var machineErr *cism.ErrNotReversible
+	err := machine.RewindTo(0)
+
+	if !errors.As(err, &machineErr) || machineErr.Event != cism.Event(3) || machine.Current() != cism.State(1) ||
+		len(machine.History()) != 2 || startErr != nil || sendErr != nil || sendErr2 != nil {
+		t.Fail()
+		t.Logf("%s: expected not reversible error, got %v", name, err)
+	}
+}